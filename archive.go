@@ -0,0 +1,461 @@
+// This file contains read-only virtual directories for archives.  An archive
+// is listed like a directory at its own path, so /tmp/src.tar.gz/lib is the
+// lib directory inside src.tar.gz.  Archives are indexed when entered and
+// indexed again when they change.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Archive extensions and their formats.  Longer extensions come first.
+var archiveFormats = []struct {
+	ext    string
+	format string
+}{
+	{".tar.gz", "tar.gz"},
+	{".tar.bz2", "tar.bz2"},
+	{".tar.xz", "tar.xz"},
+	{".tgz", "tar.gz"},
+	{".tbz2", "tar.bz2"},
+	{".tbz", "tar.bz2"},
+	{".txz", "tar.xz"},
+	{".tar", "tar"},
+	{".zip", "zip"},
+	{".jar", "zip"},
+}
+
+// Returns the format of the archive name, or "" if it is not an archive
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	for _, f := range archiveFormats {
+		if strings.HasSuffix(lower, f.ext) && len(lower) > len(f.ext) {
+			return f.format
+		}
+	}
+	return ""
+}
+
+// A file in an archive as it is listed.  It is both the DirEntry and the
+// FileInfo of the file.
+type archiveEntry struct {
+	archive string // Path of the archive
+	inner   string // Path in the archive
+	mode    fs.FileMode
+	size    int64
+	total   int64 // Size of everything under a directory
+	modTime time.Time
+}
+
+func (e *archiveEntry) Name() string               { return path.Base(e.inner) }
+func (e *archiveEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *archiveEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *archiveEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e *archiveEntry) Size() int64                { return e.size }
+func (e *archiveEntry) Mode() fs.FileMode          { return e.mode }
+func (e *archiveEntry) ModTime() time.Time         { return e.modTime }
+func (e *archiveEntry) Sys() any                   { return nil }
+
+// A file as it is read from an archive
+type archiveMember struct {
+	name     string // Cleaned path in the archive
+	mode     fs.FileMode
+	size     int64
+	modTime  time.Time
+	linkname string // Target of symlinks and hard links in tar archives
+	hardlink bool
+	outside  bool // The name leads outside of the archive with ..
+}
+
+type archiveIndex struct {
+	modTime time.Time // Of the archive when it was indexed
+	size    int64
+	entries map[string]*archiveEntry   // By path in the archive
+	dirs    map[string][]*archiveEntry // Contents of directories, "" is the top
+}
+
+// Archives indexed at most.  The archive used longest ago is dropped, and
+// indexed again if it is entered again.
+const archiveCacheSize = 4
+
+var archiveCache = map[string]*archiveIndex{}
+var archiveCacheOrder = []string{} // Paths of archiveCache, most recently used last
+
+// Adds the index of the archive at p to the cache as the most recently used
+func cacheArchive(p string, idx *archiveIndex) {
+	archiveCache[p] = idx
+	order := []string{}
+	for _, cached := range archiveCacheOrder {
+		if cached != p {
+			order = append(order, cached)
+		}
+	}
+	archiveCacheOrder = append(order, p)
+	for len(archiveCacheOrder) > archiveCacheSize {
+		delete(archiveCache, archiveCacheOrder[0])
+		archiveCacheOrder = archiveCacheOrder[1:]
+	}
+}
+
+// Splits a path inside an archive into the path of the archive and the path
+// in the archive.  Returns false if the path is not in an archive.
+func splitArchivePath(p string) (string, string, bool) {
+	p = filepath.Clean(p)
+	for dir := p; ; dir = filepath.Dir(dir) {
+		if archiveFormat(dir) != "" {
+			if info, err := os.Stat(dir); err == nil && info.Mode().IsRegular() {
+				return dir, strings.TrimPrefix(p[len(dir):], "/"), true
+			}
+		}
+		if dir == filepath.Dir(dir) {
+			return "", "", false
+		}
+	}
+}
+
+// Returns the member name cleaned and without leading slashes, or false if
+// it leads outside of the archive with ..
+func cleanMemberName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/"))
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return name, false
+	}
+	return name, true
+}
+
+// Reads the members of the archive at p in order, calling fn with each
+// member and a reader for its contents.  Members whose names lead outside
+// of the archive are marked so they can be skipped.
+func walkArchive(p string, fn func(m archiveMember, r io.Reader) error) error {
+	format := archiveFormat(p)
+	if format == "zip" {
+		return walkZip(p, fn)
+	}
+	if format == "" {
+		return fmt.Errorf("%s is not an archive", p)
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case "tar.bz2":
+		r = bzip2.NewReader(f)
+	case "tar.xz":
+		xr, err := xz.NewReader(bufio.NewReader(f))
+		if err != nil {
+			return err
+		}
+		r = xr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name, ok := cleanMemberName(hdr.Name)
+		if name == "." {
+			continue
+		}
+		m := archiveMember{
+			name:     name,
+			mode:     hdr.FileInfo().Mode(),
+			size:     hdr.Size,
+			modTime:  hdr.ModTime,
+			linkname: hdr.Linkname,
+			hardlink: hdr.Typeflag == tar.TypeLink,
+			outside:  !ok,
+		}
+		if err := fn(m, tr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZip(p string, fn func(m archiveMember, r io.Reader) error) error {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		name, ok := cleanMemberName(zf.Name)
+		if name == "." {
+			continue
+		}
+		m := archiveMember{
+			name:    name,
+			mode:    zf.Mode(),
+			size:    int64(zf.UncompressedSize64),
+			modTime: zf.Modified,
+			outside: !ok,
+		}
+
+		r, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(m, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the index of the archive at p, reading it if it changed
+func loadArchive(p string) (*archiveIndex, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if idx, found := archiveCache[p]; found && idx.modTime.Equal(info.ModTime()) && idx.size == info.Size() {
+		cacheArchive(p, idx)
+		return idx, nil
+	}
+
+	log.Printf("Indexing archive %s", p)
+	idx := &archiveIndex{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		entries: map[string]*archiveEntry{},
+		dirs:    map[string][]*archiveEntry{"": {}},
+	}
+
+	// Archives need not list the directories of their files
+	var addDir func(name string) *archiveEntry
+	add := func(name string, mode fs.FileMode, size int64, modTime time.Time) *archiveEntry {
+		if e, found := idx.entries[name]; found {
+			e.mode, e.size, e.modTime = mode, size, modTime
+			return e
+		}
+		e := &archiveEntry{archive: p, inner: name, mode: mode, size: size, modTime: modTime}
+		idx.entries[name] = e
+		parent := path.Dir(name)
+		if parent == "." {
+			parent = ""
+		} else {
+			addDir(parent)
+		}
+		idx.dirs[parent] = append(idx.dirs[parent], e)
+		return e
+	}
+	addDir = func(name string) *archiveEntry {
+		if _, found := idx.dirs[name]; !found {
+			idx.dirs[name] = []*archiveEntry{}
+		}
+		// A symlink with members under it stays a symlink, since copying
+		// it out does not make a directory
+		if e, found := idx.entries[name]; found && (e.IsDir() || e.Type() == fs.ModeSymlink) {
+			return e
+		}
+		return add(name, fs.ModeDir|0755, 0, info.ModTime())
+	}
+
+	err = walkArchive(p, func(m archiveMember, r io.Reader) error {
+		if m.outside {
+			return nil
+		}
+		if m.mode.IsDir() {
+			e := addDir(m.name)
+			e.mode, e.modTime = m.mode, m.modTime
+			return nil
+		}
+		add(m.name, m.mode, m.size, m.modTime)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, e := range idx.entries {
+		if e.IsDir() {
+			continue
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			idx.entries[dir].total += e.size
+		}
+	}
+
+	cacheArchive(p, idx)
+	return idx, nil
+}
+
+// Returns the files in the directory inner of the archive at p
+func archiveDirEntries(p string, inner string) ([]fs.DirEntry, error) {
+	idx, err := loadArchive(p)
+	if err != nil {
+		return nil, err
+	}
+	children, found := idx.dirs[inner]
+	if !found {
+		return nil, fmt.Errorf("%s is not a directory in %s", inner, p)
+	}
+
+	files := make([]fs.DirEntry, len(children))
+	for i, e := range children {
+		files[i] = e
+	}
+	return files, nil
+}
+
+// Returns true if the hovered file is an archive that can be entered
+func (m *model) isHoveredArchive() bool {
+	ct := m.CurrentTab
+	f := ct.filteredFiles[ct.cursor]
+	if archiveFormat(f.Name()) == "" {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(ct.absdir, f.Name()))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Writes the member to target, overwriting what is there like cp does
+func extractMember(m archiveMember, r io.Reader, target string) error {
+	switch {
+	case m.mode.IsDir():
+		return os.MkdirAll(target, m.mode.Perm()|0700)
+	case m.hardlink:
+		return fmt.Errorf("%s is a hard link to %s, which is not copied", m.name, m.linkname)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if m.mode&fs.ModeSymlink != 0 {
+		linkname := m.linkname
+		if linkname == "" {
+			// Zip archives keep the target as the contents
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			linkname = string(data)
+		}
+		os.Remove(target)
+		return os.Symlink(linkname, target)
+	}
+	if !m.mode.IsRegular() {
+		return fmt.Errorf("%s is not a regular file", m.name)
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, m.mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, m.modTime, m.modTime)
+}
+
+// Copies the files named by inners (and everything under them) out of the
+// archive at p into dst.  Members that would be written through a symlink,
+// like one copied out before them, are skipped.  Returns a problem for each
+// file not copied.
+func copyFromArchive(p string, inners []string, dst string) []string {
+	problems := []string{}
+
+	err := walkArchive(p, func(m archiveMember, r io.Reader) error {
+		if m.outside {
+			return nil
+		}
+		for _, inner := range inners {
+			if m.name != inner && !strings.HasPrefix(m.name, inner+"/") {
+				continue
+			}
+			rel := strings.TrimPrefix(m.name, path.Dir(inner)+"/")
+			target := filepath.Join(dst, filepath.FromSlash(rel))
+			if err := checkExtractPath(dst, target); err != nil {
+				problems = append(problems, fmt.Sprintf("Skipped %s in %s: %s", m.name, filepath.Base(p), err))
+			} else if err := extractMember(m, r, target); err != nil {
+				problems = append(problems, err.Error())
+			}
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, "Error reading "+p+": "+err.Error())
+	}
+	return problems
+}
+
+// Commands that change files, which cannot be run in or on archives
+var archiveReadOnlyCommands = []string{
+	"move", "copy", "mkdirs", "duplicate", "rename", "bulk_rename", "trash", "remove",
+	"chmod", "link_symlink_absolute", "link_symlink_relative", "link_hard",
+	"archive", "extract",
+}
+
+// Commands that run programs on files or in the directory, which need files
+// copied out of archives first
+var archiveRealFileCommands = []string{
+	"open", "open_with", "edit", "cat_to_null", "files", "shell", "editor", "du", "info", "follow_link", "checksum", "find_duplicates", "compare",
+}
+
+// Returns an error if command would change an archive or needs real files.
+// Files can be copied out of an archive but not into one.
+func (m *model) checkArchiveReadOnly(command string) error {
+	name := filepath.Base(m.CurrentTab.archive)
+	if m.CurrentTab.archive != "" && Contains(archiveRealFileCommands, command) {
+		return errors.New("Files in " + name + " must be copied out of it first")
+	}
+	if !Contains(archiveReadOnlyCommands, command) {
+		return nil
+	}
+	if m.CurrentTab.archive != "" {
+		return errors.New(name + " is read-only")
+	}
+	if command == "copy" {
+		return nil
+	}
+	for _, sf := range m.selectedFiles {
+		if e, ok := sf.file.(*archiveEntry); ok {
+			return errors.New(filepath.Base(e.archive) + " is read-only, so its files can only be copied")
+		}
+	}
+	return nil
+}
@@ -43,6 +43,8 @@ func SetBinding(key, command string) {
 	config.Bindings = new_bindings
 }
 
+// Plugins that only work on some operating systems declare themselves with
+// a manifest instead (see manifest.go)
 func SetDefaultPlugins() {
 	config.Plugins = append(config.Plugins, Plugin{
 		Section: "Navigation",
@@ -65,31 +67,6 @@ func SetDefaultPlugins() {
 		Help: "FZF on autojump results",
 	})
 
-	config.Plugins = append(config.Plugins, Plugin{
-		Section: "Operations",
-		Command: "iplugin compress",
-		Help: "Compress file",
-	})
-	config.Plugins = append(config.Plugins, Plugin{
-		Section: "Operations",
-		Command: "iplugin uncompress",
-		Help: "Uncompress (extract) file",
-	})
-	config.Plugins = append(config.Plugins, Plugin{
-		Section: "Operations",
-		Command: "plugin preview",
-		Help: "Open file(s) with Preview.app",
-	})
-	config.Plugins = append(config.Plugins, Plugin{
-		Section: "Operations",
-		Command: "plugin acrobat",
-		Help: "Open file(s) with Acrobat.app",
-	})
-	config.Plugins = append(config.Plugins, Plugin{
-		Section: "Operations",
-		Command: "plugin quicklook",
-		Help: "Open file(s) with Quicklook",
-	})
 	config.Plugins = append(config.Plugins, Plugin{
 		Section: "Operations",
 		Command: "iplugin image_compress",
@@ -115,6 +92,10 @@ func SetDefaultBindings() {
 	SetBinding("5",         "tab 5")
 	SetBinding("6",         "tab 6")
 	SetBinding("ctrl+s",    "selected_files")
+	SetBinding("b",         "jobs")
+	SetBinding("u",         "du")
+	SetBinding("ctrl+g",    "info")
+	SetBinding("ctrl+x",    "cancel_job")
 
 	// Filtering
 	SetBinding("/",         "filter")
@@ -144,6 +125,10 @@ func SetDefaultBindings() {
 	SetBinding("l",         "enter_directory")
 	SetBinding("enter",     "enter_directory")
 
+	SetBinding("t",         "tree")
+	SetBinding(" ",         "expand")
+	SetBinding("E",         "flatten")
+
 	SetBinding("~",         "home")
 	SetBinding("ctrl+o",    "history_back")
 	SetBinding("tab",       "history_forward")
@@ -160,6 +145,14 @@ func SetDefaultBindings() {
 	SetBinding("n",         "sort_name")
 	SetBinding("m",         "sort_modified")
 	SetBinding("z",         "sort_size")
+	SetBinding("#",         "sort_natural")
+	SetBinding("x",         "sort_extension")
+	SetBinding("M",         "sort_created")
+	SetBinding("K",         "sort_type")
+	SetBinding("r",         "sort_reverse")
+	SetBinding("f",         "sort_dirs_first")
+	SetBinding("i",         "sort_case")
+	SetBinding("ctrl+t",    "toggle_dir_sizes")
 
 	// Selection
 	SetBinding("s",         "select")
@@ -169,13 +162,19 @@ func SetDefaultBindings() {
 	// Operations
 	SetBinding("v",         "move")
 	SetBinding("p",         "copy")
+	SetBinding("y",         "link_symlink_absolute")
+	SetBinding("Y",         "link_symlink_relative")
+	SetBinding("H",         "link_hard")
+	SetBinding("ctrl+f",    "follow_link")
 	SetBinding("o",         "open")
+	SetBinding("w",         "open_with")
 	SetBinding("e",         "edit")
 
 	SetBinding("N",         "mkdirs")
 	SetBinding("D",         "duplicate")
 	SetBinding("R",         "rename")
 	SetBinding("ctrl+r",    "bulk_rename")
+	SetBinding("ctrl+p",    "chmod")
 	SetBinding("T",         "trash")
 	SetBinding("X",         "remove") // This runs interactive plugin: remove
 
@@ -183,11 +182,11 @@ func SetDefaultBindings() {
 	SetBinding("V",         "editor")
 	SetBinding("F",         "files")
 
-	SetBinding("C",         "iplugin compress")
-	SetBinding("U",         "iplugin uncompress")
-	SetBinding("P",         "plugin preview")
-	SetBinding("O",         "plugin acrobat")
-	SetBinding("L",         "plugin quicklook")
+	SetBinding("C",         "archive")
+	SetBinding("U",         "extract")
+	SetBinding("c",         "checksum")
+	SetBinding("W",         "find_duplicates")
+	SetBinding("=",         "compare")
 	SetBinding("I",         "iplugin image_compress")
 	SetBinding("Z",         "iplugin lazygit")
 
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package main
+
+import "time"
+
+// Birth times are not read on this platform
+func birthTime(path string) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,458 @@
+// This file contains the checksum command.  It hashes files in parallel in a
+// background job with the algorithm picked in fzf and shows the sums in a
+// panel, from which a checksum file like SHA256SUMS can be written.  On a
+// checksum file, it verifies the files listed.
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/blake2b"
+)
+
+type checksumPickedMsg struct {
+	algorithm string
+	paths     []string
+}
+
+type checksumAlgorithm struct {
+	name     string
+	sumsFile string // Named like the files written by sha256sum and friends
+	new      func() hash.Hash
+}
+
+// sha256 is first so fzf picks it by default
+var checksumAlgorithms = []checksumAlgorithm{
+	{"sha256", "SHA256SUMS", sha256.New},
+	{"sha512", "SHA512SUMS", sha512.New},
+	{"blake2b", "B2SUMS", func() hash.Hash {
+		h, _ := blake2b.New512(nil)
+		return h
+	}},
+	{"sha1", "SHA1SUMS", sha1.New},
+	{"md5", "MD5SUMS", md5.New},
+}
+
+// Names of checksum files, like SHA256SUMS or release.sha256
+var checksumFileRe = regexp.MustCompile(`(?i)^((md5|sha1|sha256|sha512|b2|blake2b)sums?|checksums?)(\.txt)?$|\.(md5|sha1|sha256|sha512|b2)$`)
+
+// Lines of checksum files.  GNU lines mark binary files with *, BSD lines
+// (--tag) name the algorithm.
+var (
+	gnuChecksumRe = regexp.MustCompile(`^\\?([0-9a-fA-F]+) [ *](.+)$`)
+	bsdChecksumRe = regexp.MustCompile(`^\\?([A-Za-z0-9-]+) \((.+)\) = ([0-9a-fA-F]+)$`)
+	hexRe         = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+)
+
+type checksumResult struct {
+	name string // Path from the root, as written to the checksum file
+	sum  string
+	err  error
+}
+
+// A line of a checksum file and what verifying it found
+type checksumEntry struct {
+	algorithm string
+	sum       string
+	name      string
+	status    string // OK, FAILED or MISSING
+	err       error
+}
+
+// Returns the sums of the file at path with the algorithms, in order
+func hashFile(h *jobHandle, path string, algorithms []checksumAlgorithm) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make([]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, len(algorithms))
+	for i, a := range algorithms {
+		hashes[i] = a.new()
+		writers[i] = hashes[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), jobReader{h, f}); err != nil {
+		return nil, err
+	}
+
+	sums := make([]string, len(hashes))
+	for i, hh := range hashes {
+		sums[i] = hex.EncodeToString(hh.Sum(nil))
+	}
+	return sums, nil
+}
+
+// Runs work for 0 to count-1 on a worker per CPU.  Progress is reported
+// with status, which formats the number done and count.
+func runParallel(h *jobHandle, status string, count int, work func(i int)) {
+	var wg sync.WaitGroup
+	var done atomic.Int64
+	next := make(chan int)
+
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				work(i)
+				h.Status(fmt.Sprintf(status, done.Add(1), count))
+			}
+		}()
+	}
+
+	for i := 0; i < count && !h.Cancelled(); i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// Returns the regular files at paths and under the directories at paths
+func collectFiles(paths []string) []string {
+	files := []string{}
+	for _, path := range paths {
+		filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			// Symlinks are followed like sha256sum does
+			if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+				files = append(files, p)
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// Returns the algorithm named name
+func findChecksumAlgorithm(name string) (checksumAlgorithm, bool) {
+	for _, a := range checksumAlgorithms {
+		if a.name == name {
+			return a, true
+		}
+	}
+	return checksumAlgorithm{}, false
+}
+
+// Lets the user pick the algorithm to hash the selected files (or the
+// hovered file) with, or verifies the hovered checksum file
+func (m *model) Checksum() tea.Cmd {
+	if len(m.selectedFiles) == 0 && m.isHoveredValid() && checksumFileRe.MatchString(m.CurrentTab.filteredFiles[m.CurrentTab.cursor].Name()) {
+		return m.VerifyChecksums(m.getHoveredPath())
+	}
+
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		m.appendError("No files to checksum")
+		return nil
+	}
+
+	names := []string{}
+	for _, a := range checksumAlgorithms {
+		names = append(names, a.name)
+	}
+	return PickWithFzf("Checksum with> ", names, func(name string) tea.Msg {
+		return checksumPickedMsg{name, paths}
+	})
+}
+
+// Hashes paths with the algorithm named name
+func (m *model) ChecksumFiles(name string, paths []string) tea.Cmd {
+	a, found := findChecksumAlgorithm(name)
+	if !found {
+		m.appendError("Unknown checksum algorithm " + name)
+		return nil
+	}
+	root := commonRoot(paths)
+
+	return m.StartJob(fmt.Sprintf("%s of %d files", a.name, len(paths)), func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		files := collectFiles(paths)
+		results := make([]checksumResult, len(files))
+		runParallel(h, "%d/%d files", len(files), func(i int) {
+			name, _ := filepath.Rel(root, files[i])
+			result := checksumResult{name: filepath.ToSlash(name)}
+			sums, err := hashFile(h, files[i], []checksumAlgorithm{a})
+			if err != nil {
+				result.err = err
+			} else {
+				result.sum = sums[0]
+			}
+			results[i] = result
+		})
+		if h.Cancelled() {
+			return nil, nil
+		}
+		h.Log(fmt.Sprintf("Hashed %d files in %s with %s", len(files), root, a.name))
+
+		return func(m *model) tea.Cmd {
+			m.showChecksums(root, a, results)
+			return nil
+		}, nil
+	})
+}
+
+func (m *model) showChecksums(root string, a checksumAlgorithm, results []checksumResult) {
+	written := ""
+
+	render := func(m *model) string {
+		// Long sums are wrapped after the label
+		width := Max(16, m.termWidth-16)
+
+		doc := strings.Builder{}
+		doc.WriteString(rSection("Checksums") + "\n")
+		writeInfoLine(&doc, "Files", fmt.Sprintf("%d in %s", len(results), root))
+		if written != "" {
+			writeInfoLine(&doc, "Written", written)
+		} else {
+			writeInfoLine(&doc, "", "w writes "+a.sumsFile)
+		}
+
+		for _, r := range results {
+			name, _ := escapeChecksumName(r.name)
+			doc.WriteString("\n" + rSection(name) + "\n")
+			if r.err != nil {
+				doc.WriteString("  " + failedStyle.Render(r.err.Error()) + "\n")
+				continue
+			}
+			label, sum := a.name, r.sum
+			for len(sum) > width {
+				writeInfoLine(&doc, label, sum[:width])
+				label, sum = "", sum[width:]
+			}
+			writeInfoLine(&doc, label, sum)
+		}
+		return doc.String()
+	}
+
+	keys := func(m *model, key string) tea.Cmd {
+		if key != "w" {
+			return nil
+		}
+		path, err := writeSums(root, a, results)
+		if err != nil {
+			m.appendError("Error writing " + path + ": " + err.Error())
+			return nil
+		}
+		written = path
+		m.viewport.SetContent(m.generateContent())
+		m.emitHook(onOperation, []string{path}, map[string]string{"operation": "checksum"})
+		return nil
+	}
+
+	m.mode = panelMode
+	m.panel = panel{title: "CHECKSUM", render: render, keys: keys}
+	m.viewport.SetContent(m.generateContent())
+	m.viewport.GotoTop()
+}
+
+// Writes the sums of the results to the checksum file of the algorithm in
+// root (like SHA256SUMS), which sha256sum -c and friends can check.  An
+// existing checksum file is kept.
+func writeSums(root string, a checksumAlgorithm, results []checksumResult) (string, error) {
+	doc := strings.Builder{}
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		name, escaped := escapeChecksumName(r.name)
+		if escaped {
+			doc.WriteString("\\")
+		}
+		doc.WriteString(r.sum + "  " + name + "\n")
+	}
+
+	path := availablePath(root, a.sumsFile, "")
+	return path, os.WriteFile(path, []byte(doc.String()), 0644)
+}
+
+// Returns the algorithm of a sum of n hex digits.  Both sha512 and blake2b
+// sums have 128, so the name of the checksum file decides.
+func algorithmForLength(n int, fileName string) string {
+	switch n {
+	case 32:
+		return "md5"
+	case 40:
+		return "sha1"
+	case 64:
+		return "sha256"
+	case 128:
+		lower := strings.ToLower(fileName)
+		if strings.HasPrefix(lower, "b2") || strings.Contains(lower, "blake2b") || strings.HasSuffix(lower, ".b2") {
+			return "blake2b"
+		}
+		return "sha512"
+	}
+	return ""
+}
+
+// Parses a line of the checksum file named fileName.  Returns false if the
+// line is not a checksum.
+func parseChecksumLine(line string, fileName string) (checksumEntry, bool) {
+	if match := bsdChecksumRe.FindStringSubmatch(line); match != nil {
+		algorithm := strings.ToLower(match[1])
+		if algorithm == "blake2b-512" {
+			algorithm = "blake2b"
+		}
+		return checksumEntry{algorithm: algorithm, sum: strings.ToLower(match[3]), name: unescapeChecksumName(line, match[2])}, true
+	}
+
+	if match := gnuChecksumRe.FindStringSubmatch(line); match != nil {
+		algorithm := algorithmForLength(len(match[1]), fileName)
+		return checksumEntry{algorithm: algorithm, sum: strings.ToLower(match[1]), name: unescapeChecksumName(line, match[2])}, algorithm != ""
+	}
+
+	// Files like release.iso.sha256 may have only the sum of release.iso
+	if sum := strings.TrimSpace(line); hexRe.MatchString(sum) {
+		algorithm := algorithmForLength(len(sum), fileName)
+		name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		return checksumEntry{algorithm: algorithm, sum: strings.ToLower(sum), name: name}, algorithm != ""
+	}
+
+	return checksumEntry{}, false
+}
+
+// Escapes \, newlines and carriage returns in name like sha256sum does.
+// Returns true if anything was escaped, which is marked by starting the line
+// with \.
+func escapeChecksumName(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return name, false
+	}
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(name), true
+}
+
+// GNU checksum lines starting with \ have names with \\, \n and \r escaped
+func unescapeChecksumName(line string, name string) string {
+	if !strings.HasPrefix(line, "\\") {
+		return name
+	}
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(name)
+}
+
+// Hashes the files listed in the checksum file at path, which are relative
+// to its directory, and shows which match
+func (m *model) VerifyChecksums(path string) tea.Cmd {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		m.appendError("Error reading " + path + ": " + err.Error())
+		return nil
+	}
+
+	fileName := filepath.Base(path)
+	entries := []checksumEntry{}
+	improper := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if entry, ok := parseChecksumLine(line, fileName); ok {
+			entries = append(entries, entry)
+		} else {
+			improper++
+		}
+	}
+	if len(entries) == 0 {
+		m.appendError("No checksums found in " + path)
+		return nil
+	}
+
+	algorithms := map[string]checksumAlgorithm{}
+	for _, a := range checksumAlgorithms {
+		algorithms[a.name] = a
+	}
+	dir := filepath.Dir(path)
+
+	return m.StartJob("verify "+fileName, func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		runParallel(h, "%d/%d files", len(entries), func(i int) {
+			e := &entries[i]
+			a, found := algorithms[e.algorithm]
+			if !found {
+				e.status, e.err = "FAILED", fmt.Errorf("unknown algorithm %s", e.algorithm)
+				return
+			}
+
+			target := e.name
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(dir, target)
+			}
+			sums, err := hashFile(h, target, []checksumAlgorithm{a})
+			switch {
+			case os.IsNotExist(err):
+				e.status = "MISSING"
+			case err != nil:
+				e.status, e.err = "FAILED", err
+			case sums[0] != e.sum:
+				e.status = "FAILED"
+			default:
+				e.status = "OK"
+			}
+		})
+		if h.Cancelled() {
+			return nil, nil
+		}
+
+		counts := map[string]int{}
+		for _, e := range entries {
+			counts[e.status]++
+		}
+		h.Log(fmt.Sprintf("%s: %d OK, %d FAILED, %d MISSING", path, counts["OK"], counts["FAILED"], counts["MISSING"]))
+
+		return func(m *model) tea.Cmd {
+			m.showVerification(path, entries, counts, improper)
+			return nil
+		}, nil
+	})
+}
+
+func (m *model) showVerification(path string, entries []checksumEntry, counts map[string]int, improper int) {
+	doc := strings.Builder{}
+	doc.WriteString(rSection("Verify") + "\n")
+	writeInfoLine(&doc, "File", path)
+	writeInfoLine(&doc, "OK", fmt.Sprintf("%d", counts["OK"]))
+	writeInfoLine(&doc, "FAILED", fmt.Sprintf("%d", counts["FAILED"]))
+	writeInfoLine(&doc, "MISSING", fmt.Sprintf("%d", counts["MISSING"]))
+	if improper > 0 {
+		writeInfoLine(&doc, "Improper", fmt.Sprintf("%d (lines that are not checksums)", improper))
+	}
+
+	doc.WriteString("\n" + rSection("Files") + "\n")
+	for _, e := range entries {
+		style := okStyle
+		if e.status != "OK" {
+			style = failedStyle
+		}
+		name, _ := escapeChecksumName(e.name)
+		line := fmt.Sprintf("  %s %s (%s)", style.Render(fmt.Sprintf("%-8s", e.status)), name, e.algorithm)
+		if e.err != nil {
+			line += ": " + e.err.Error()
+		}
+		doc.WriteString(line + "\n")
+	}
+
+	text := doc.String()
+	m.mode = panelMode
+	m.panel = panel{title: "VERIFY", render: func(*model) string { return text }}
+	m.viewport.SetContent(m.generateContent())
+	m.viewport.GotoTop()
+}
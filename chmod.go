@@ -0,0 +1,265 @@
+// This file contains the permissions editor.  Like bulk rename, it writes a
+// line for each file to a temporary file, opens it in EDITOR, and applies
+// what changed when the editor exits.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A file as it was written to the temporary file
+type chmodEntry struct {
+	path  string
+	name  string // As shown, which is the path for files outside the tab
+	mode  fs.FileMode
+	owner string
+	group string
+}
+
+type chmodFinishedMsg struct {
+	tmppath string
+	entries []chmodEntry
+}
+
+// Mode bits that chmod changes
+const chmodBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// Parses the permissions part of ls -l (rwxr-xr-x) or an octal mode (755)
+func parsePermissions(s string) (fs.FileMode, error) {
+	if n, err := strconv.ParseUint(s, 8, 32); err == nil && len(s) <= 4 {
+		mode := fs.FileMode(n & 0777)
+		if n&04000 != 0 {
+			mode |= fs.ModeSetuid
+		}
+		if n&02000 != 0 {
+			mode |= fs.ModeSetgid
+		}
+		if n&01000 != 0 {
+			mode |= fs.ModeSticky
+		}
+		return mode, nil
+	}
+
+	if len(s) != 9 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+
+	var mode fs.FileMode
+	special := []fs.FileMode{fs.ModeSetuid, fs.ModeSetgid, fs.ModeSticky}
+	for i := 0; i < 9; i++ {
+		bit := fs.FileMode(1) << uint(8-i)
+		c := s[i]
+		switch {
+		case c == "rwxrwxrwx"[i]:
+			mode |= bit
+		case c == '-':
+		case i%3 == 2 && c == "sst"[i/3]:
+			mode |= bit | special[i/3]
+		case i%3 == 2 && c == "SST"[i/3]:
+			mode |= special[i/3]
+		default:
+			return 0, fmt.Errorf("invalid mode %q", s)
+		}
+	}
+	return mode, nil
+}
+
+// Returns the uid of the user name, which may also be a number
+func lookupUid(name string) (int, error) {
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// Returns the gid of the group name, which may also be a number
+func lookupGid(name string) (int, error) {
+	if gid, err := strconv.Atoi(name); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// Splits a line of the temporary file into mode, user, group, and name.
+// Names may contain spaces.
+func splitChmodLine(line string) ([]string, bool) {
+	fields := []string{}
+	rest := line
+	for len(fields) < 3 {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end == -1 {
+			return nil, false
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end+1:]
+	}
+	return append(fields, rest), true
+}
+
+// Opens the permissions and owners of the selected files (or the files in
+// the listing) in EDITOR
+func (m *model) EditPermissions() tea.Cmd {
+	ct := m.CurrentTab
+
+	paths := []string{}
+	if len(m.selectedFiles) > 0 {
+		for _, sf := range m.selectedFiles {
+			paths = append(paths, filepath.Join(sf.directory, sf.file.Name()))
+		}
+	} else {
+		for _, f := range ct.filteredFiles {
+			paths = append(paths, filepath.Join(ct.absdir, f.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		m.appendError("No files to change permissions of")
+		return nil
+	}
+
+	t, err := os.CreateTemp(os.Getenv("TMPDIR"), "M-CHMOD")
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Created TMP File: %s", t.Name())
+
+	entries := []chmodEntry{}
+	w := bufio.NewWriter(t)
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			m.appendError("Error reading " + path + ": " + err.Error())
+			continue
+		}
+
+		name := filepath.Base(path)
+		if filepath.Dir(path) != ct.absdir {
+			name = path
+		}
+		owner, group := fileOwner(info)
+		entries = append(entries, chmodEntry{path, name, info.Mode(), owner, group})
+		fmt.Fprintf(w, "%s %s %s %s\n", lsMode(info.Mode())[1:], owner, group, name)
+	}
+	fmt.Fprintf(w, "; Change the mode (rwxr-xr-x or 755), user, and group.  Names cannot be changed.\n")
+	fmt.Fprintf(w, "; CWD: %s\n", ct.directory)
+
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := t.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	c := exec.Command(Editor(), t.Name()) //nolint:gosec
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		if err != nil {
+			os.Remove(t.Name())
+			log.Printf("User cancelled chmod")
+			return refreshMsg(0)
+		}
+		return chmodFinishedMsg{t.Name(), entries}
+	})
+}
+
+// Applies the modes and owners that were changed in the temporary file
+func (m *model) FinishEditPermissions(f string, entries []chmodEntry) tea.Cmd {
+	data, err := os.ReadFile(f)
+	os.Remove(f)
+	if err != nil {
+		m.appendError("Error reading temporary file " + f + ": " + err.Error())
+		return nil
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != len(entries) {
+		m.appendError(fmt.Sprintf("Expected %d lines but found %d.  Nothing was changed.", len(entries), len(lines)))
+		return nil
+	}
+
+	var changed []string
+	var errors []string
+	for i, line := range lines {
+		e := entries[i]
+
+		fields, ok := splitChmodLine(line)
+		if !ok || fields[3] != e.name {
+			errors = append(errors, fmt.Sprintf("%s: line %d does not match (names cannot be changed)", e.name, i+1))
+			continue
+		}
+
+		mode, err := parsePermissions(fields[0])
+		if err != nil {
+			errors = append(errors, e.name+": "+err.Error())
+			continue
+		}
+
+		if mode != e.mode&chmodBits {
+			if e.mode&fs.ModeSymlink != 0 {
+				errors = append(errors, e.name+": symlinks have no mode of their own")
+			} else if err := os.Chmod(e.path, mode); err != nil {
+				errors = append(errors, e.name+": "+err.Error())
+			} else {
+				log.Printf("Changed mode of %s to %s", e.path, fields[0])
+				changed = append(changed, e.path)
+			}
+		}
+
+		if fields[1] != e.owner || fields[2] != e.group {
+			uid, gid := -1, -1
+			if fields[1] != e.owner {
+				if uid, err = lookupUid(fields[1]); err != nil {
+					errors = append(errors, e.name+": unknown user "+fields[1])
+					continue
+				}
+			}
+			if fields[2] != e.group {
+				if gid, err = lookupGid(fields[2]); err != nil {
+					errors = append(errors, e.name+": unknown group "+fields[2])
+					continue
+				}
+			}
+			if err := os.Lchown(e.path, uid, gid); err != nil {
+				errors = append(errors, e.name+": "+err.Error())
+			} else {
+				log.Printf("Changed owner of %s to %s:%s", e.path, fields[1], fields[2])
+				if !Contains(changed, e.path) {
+					changed = append(changed, e.path)
+				}
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		m.appendError("Problems changing permissions:\n\n" + strings.Join(errors, "\n"))
+	}
+	if len(changed) > 0 {
+		m.emitHook(onOperation, changed, map[string]string{"operation": "chmod"})
+	}
+	return refresh()
+}
@@ -0,0 +1,338 @@
+// This file contains code for classifying files.  Files are classified by
+// extension, or by sniffing the first bytes of the file (magic numbers) if
+// the extension is missing or unknown.  Icons, styles, openers, and filter
+// predicates share the result.
+
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fileCategory int
+
+const (
+	categoryUnknown fileCategory = iota
+	categoryDirectory
+	categorySymlink
+	categoryDevice
+	categoryPipe
+	categorySocket
+	categoryText
+	categoryCode
+	categoryImage
+	categoryAudio
+	categoryVideo
+	categoryArchive
+	categoryDocument
+	categorySpreadsheet
+	categoryPresentation
+	categoryPDF
+	categoryFont
+	categoryExecutable
+)
+
+// Names are used by filter predicates (@image) and config files
+var categoryNames = map[fileCategory]string{
+	categoryUnknown:      "unknown",
+	categoryDirectory:    "directory",
+	categorySymlink:      "symlink",
+	categoryDevice:       "device",
+	categoryPipe:         "pipe",
+	categorySocket:       "socket",
+	categoryText:         "text",
+	categoryCode:         "code",
+	categoryImage:        "image",
+	categoryAudio:        "audio",
+	categoryVideo:        "video",
+	categoryArchive:      "archive",
+	categoryDocument:     "document",
+	categorySpreadsheet:  "spreadsheet",
+	categoryPresentation: "presentation",
+	categoryPDF:          "pdf",
+	categoryFont:         "font",
+	categoryExecutable:   "executable",
+}
+
+func (c fileCategory) String() string {
+	return categoryNames[c]
+}
+
+// Returns the category with name, or false if there is none
+func parseCategory(name string) (fileCategory, bool) {
+	for c, n := range categoryNames {
+		if n == name {
+			return c, true
+		}
+	}
+	return categoryUnknown, false
+}
+
+type fileClass struct {
+	category fileCategory
+	mime     string
+}
+
+// Extensions are lower case without the dot
+var extensionClasses = map[string]fileClass{
+	// Text
+	"txt":  {categoryText, "text/plain"},
+	"md":   {categoryText, "text/markdown"},
+	"rst":  {categoryText, "text/x-rst"},
+	"log":  {categoryText, "text/plain"},
+	"csv":  {categoryText, "text/csv"},
+	"tsv":  {categoryText, "text/tab-separated-values"},
+	"json": {categoryText, "application/json"},
+	"yaml": {categoryText, "application/yaml"},
+	"yml":  {categoryText, "application/yaml"},
+	"toml": {categoryText, "application/toml"},
+	"ini":  {categoryText, "text/plain"},
+	"conf": {categoryText, "text/plain"},
+	"xml":  {categoryText, "application/xml"},
+
+	// Code
+	"html": {categoryCode, "text/html"},
+	"htm":  {categoryCode, "text/html"},
+	"css":  {categoryCode, "text/css"},
+	"js":   {categoryCode, "text/javascript"},
+	"ts":   {categoryCode, "text/typescript"},
+	"go":   {categoryCode, "text/x-go"},
+	"c":    {categoryCode, "text/x-c"},
+	"h":    {categoryCode, "text/x-c"},
+	"cpp":  {categoryCode, "text/x-c++"},
+	"hpp":  {categoryCode, "text/x-c++"},
+	"java": {categoryCode, "text/x-java"},
+	"py":   {categoryCode, "text/x-python"},
+	"rb":   {categoryCode, "text/x-ruby"},
+	"rs":   {categoryCode, "text/x-rust"},
+	"lua":  {categoryCode, "text/x-lua"},
+	"sh":   {categoryCode, "text/x-shellscript"},
+	"bash": {categoryCode, "text/x-shellscript"},
+	"zsh":  {categoryCode, "text/x-shellscript"},
+	"vim":  {categoryCode, "text/plain"},
+	"sql":  {categoryCode, "application/sql"},
+
+	// Images
+	"png":  {categoryImage, "image/png"},
+	"jpg":  {categoryImage, "image/jpeg"},
+	"jpeg": {categoryImage, "image/jpeg"},
+	"gif":  {categoryImage, "image/gif"},
+	"webp": {categoryImage, "image/webp"},
+	"bmp":  {categoryImage, "image/bmp"},
+	"tif":  {categoryImage, "image/tiff"},
+	"tiff": {categoryImage, "image/tiff"},
+	"svg":  {categoryImage, "image/svg+xml"},
+	"ico":  {categoryImage, "image/vnd.microsoft.icon"},
+	"heic": {categoryImage, "image/heic"},
+	"psd":  {categoryImage, "image/vnd.adobe.photoshop"},
+
+	// Audio
+	"mp3":  {categoryAudio, "audio/mpeg"},
+	"wav":  {categoryAudio, "audio/wav"},
+	"flac": {categoryAudio, "audio/flac"},
+	"ogg":  {categoryAudio, "audio/ogg"},
+	"m4a":  {categoryAudio, "audio/mp4"},
+	"aac":  {categoryAudio, "audio/aac"},
+
+	// Video
+	"mp4":  {categoryVideo, "video/mp4"},
+	"m4v":  {categoryVideo, "video/mp4"},
+	"mkv":  {categoryVideo, "video/x-matroska"},
+	"mov":  {categoryVideo, "video/quicktime"},
+	"avi":  {categoryVideo, "video/x-msvideo"},
+	"webm": {categoryVideo, "video/webm"},
+
+	// Archives
+	"zip": {categoryArchive, "application/zip"},
+	"tar": {categoryArchive, "application/x-tar"},
+	"tgz": {categoryArchive, "application/gzip"},
+	"gz":  {categoryArchive, "application/gzip"},
+	"bz2": {categoryArchive, "application/x-bzip2"},
+	"xz":  {categoryArchive, "application/x-xz"},
+	"7z":  {categoryArchive, "application/x-7z-compressed"},
+	"rar": {categoryArchive, "application/vnd.rar"},
+	"dmg": {categoryArchive, "application/x-apple-diskimage"},
+	"iso": {categoryArchive, "application/x-iso9660-image"},
+
+	// Documents
+	"pdf":  {categoryPDF, "application/pdf"},
+	"doc":  {categoryDocument, "application/msword"},
+	"docx": {categoryDocument, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	"odt":  {categoryDocument, "application/vnd.oasis.opendocument.text"},
+	"rtf":  {categoryDocument, "application/rtf"},
+	"xls":  {categorySpreadsheet, "application/vnd.ms-excel"},
+	"xlsx": {categorySpreadsheet, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	"xlsm": {categorySpreadsheet, "application/vnd.ms-excel.sheet.macroEnabled.12"},
+	"ods":  {categorySpreadsheet, "application/vnd.oasis.opendocument.spreadsheet"},
+	"ppt":  {categoryPresentation, "application/vnd.ms-powerpoint"},
+	"pptx": {categoryPresentation, "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	"odp":  {categoryPresentation, "application/vnd.oasis.opendocument.presentation"},
+
+	// Fonts
+	"ttf":   {categoryFont, "font/ttf"},
+	"otf":   {categoryFont, "font/otf"},
+	"woff":  {categoryFont, "font/woff"},
+	"woff2": {categoryFont, "font/woff2"},
+
+	// Executables
+	"exe":      {categoryExecutable, "application/vnd.microsoft.portable-executable"},
+	"app":      {categoryExecutable, "application/octet-stream"},
+	"appimage": {categoryExecutable, "application/vnd.appimage"},
+}
+
+type magic struct {
+	offset int
+	bytes  []byte
+	class  fileClass
+}
+
+// Checked in order, so longer signatures come first
+var magics = []magic{
+	{0, []byte("\x7fELF"), fileClass{categoryExecutable, "application/x-executable"}},
+	{0, []byte("\xcf\xfa\xed\xfe"), fileClass{categoryExecutable, "application/x-mach-binary"}},
+	{0, []byte("\xce\xfa\xed\xfe"), fileClass{categoryExecutable, "application/x-mach-binary"}},
+	{0, []byte("\xca\xfe\xba\xbe"), fileClass{categoryExecutable, "application/x-mach-binary"}},
+	{0, []byte("MZ"), fileClass{categoryExecutable, "application/vnd.microsoft.portable-executable"}},
+	{0, []byte("#!"), fileClass{categoryExecutable, "text/x-shellscript"}},
+	{0, []byte("%PDF-"), fileClass{categoryPDF, "application/pdf"}},
+	{0, []byte("\x89PNG\r\n\x1a\n"), fileClass{categoryImage, "image/png"}},
+	{0, []byte("\xff\xd8\xff"), fileClass{categoryImage, "image/jpeg"}},
+	{0, []byte("GIF8"), fileClass{categoryImage, "image/gif"}},
+	{8, []byte("WEBP"), fileClass{categoryImage, "image/webp"}},
+	{8, []byte("WAVE"), fileClass{categoryAudio, "audio/wav"}},
+	{8, []byte("AVI "), fileClass{categoryVideo, "video/x-msvideo"}},
+	{0, []byte("ID3"), fileClass{categoryAudio, "audio/mpeg"}},
+	{0, []byte("fLaC"), fileClass{categoryAudio, "audio/flac"}},
+	{0, []byte("OggS"), fileClass{categoryAudio, "audio/ogg"}},
+	{4, []byte("ftyp"), fileClass{categoryVideo, "video/mp4"}},
+	{0, []byte("\x1a\x45\xdf\xa3"), fileClass{categoryVideo, "video/x-matroska"}},
+	{0, []byte("PK\x03\x04"), fileClass{categoryArchive, "application/zip"}},
+	{0, []byte("\x1f\x8b"), fileClass{categoryArchive, "application/gzip"}},
+	{0, []byte("BZh"), fileClass{categoryArchive, "application/x-bzip2"}},
+	{0, []byte("\xfd7zXZ\x00"), fileClass{categoryArchive, "application/x-xz"}},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), fileClass{categoryArchive, "application/x-7z-compressed"}},
+	{257, []byte("ustar"), fileClass{categoryArchive, "application/x-tar"}},
+}
+
+// Number of bytes read from the start of a file for sniffing
+const sniffLength = 512
+
+type classCacheEntry struct {
+	modTime time.Time
+	size    int64
+	class   fileClass
+}
+
+// Sniffing reads the file, so results are cached until the file changes
+var classCache = map[string]classCacheEntry{}
+var classCacheLock sync.Mutex
+
+// Returns the lower case extension of name without the dot
+func fileExtension(name string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+}
+
+// Classifies the contents of the file at path by magic numbers
+func sniff(path string) fileClass {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileClass{categoryUnknown, ""}
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLength)
+	n, _ := f.Read(buf)
+	buf = buf[:n]
+
+	if n == 0 {
+		return fileClass{categoryText, "text/plain"}
+	}
+
+	for _, m := range magics {
+		end := m.offset + len(m.bytes)
+		if end <= n && bytes.Equal(buf[m.offset:end], m.bytes) {
+			return m.class
+		}
+	}
+
+	mimeType := http.DetectContentType(buf)
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return fileClass{categoryText, mimeType}
+	case strings.HasPrefix(mimeType, "image/"):
+		return fileClass{categoryImage, mimeType}
+	case strings.HasPrefix(mimeType, "audio/"):
+		return fileClass{categoryAudio, mimeType}
+	case strings.HasPrefix(mimeType, "video/"):
+		return fileClass{categoryVideo, mimeType}
+	}
+	return fileClass{categoryUnknown, mimeType}
+}
+
+// Classifies the file by type, extension, and contents
+func classifyInfo(path string, info fs.FileInfo) fileClass {
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		return fileClass{categoryDirectory, "inode/directory"}
+	case mode&os.ModeSymlink != 0:
+		return fileClass{categorySymlink, "inode/symlink"}
+	case mode&os.ModeDevice != 0:
+		return fileClass{categoryDevice, "inode/blockdevice"}
+	case mode&os.ModeNamedPipe != 0:
+		return fileClass{categoryPipe, "inode/fifo"}
+	case mode&os.ModeSocket != 0:
+		return fileClass{categorySocket, "inode/socket"}
+	}
+
+	if class, found := extensionClasses[fileExtension(path)]; found {
+		return class
+	}
+
+	classCacheLock.Lock()
+	cached, found := classCache[path]
+	classCacheLock.Unlock()
+	if found && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.class
+	}
+
+	class := sniff(path)
+	if mode.Perm()&0111 != 0 && (class.category == categoryUnknown || class.category == categoryText) {
+		class.category = categoryExecutable
+	}
+
+	classCacheLock.Lock()
+	classCache[path] = classCacheEntry{info.ModTime(), info.Size(), class}
+	classCacheLock.Unlock()
+
+	return class
+}
+
+// Classifies the file f in dir
+func classify(dir string, f fs.DirEntry) fileClass {
+	if f.IsDir() || isSymDir(dir, f) {
+		return fileClass{categoryDirectory, "inode/directory"}
+	}
+
+	info, err := f.Info()
+	if err != nil {
+		return fileClass{categoryUnknown, ""}
+	}
+	return classifyInfo(filepath.Join(dir, f.Name()), info)
+}
+
+// Classifies the file at path, following symlinks
+func classifyPath(path string) fileClass {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileClass{categoryUnknown, ""}
+	}
+	return classifyInfo(path, info)
+}
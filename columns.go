@@ -0,0 +1,443 @@
+// This file contains the columns of the listing, which are set with columns
+// in bfmrc.  Columns other than name drop off by priority when the terminal
+// is too narrow for them.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Names are never truncated below this to make room for other columns.  At
+// 34, the default columns drop off below a width of 50.
+const minNameWidth = 34
+
+var defaultColumns = []string{"name", "mtime", "size"}
+
+// A column of the listing other than name
+type columnDef struct {
+	priority      int // Columns with a higher priority are dropped first
+	defaultFormat string
+	formats       []string // Allowed formats, or nil for any (like strftime)
+	width         func(format string) int
+	cell          func(dir string, f fs.DirEntry, info fs.FileInfo, format string) (string, lipgloss.Style)
+}
+
+var columnDefs = map[string]columnDef{
+	"size": {
+		priority:      1,
+		defaultFormat: "iec",
+		formats:       []string{"iec", "si", "bytes"},
+		width:         sizeWidth,
+		cell:          sizeCell,
+	},
+	"mtime": {
+		priority:      2,
+		defaultFormat: "relative",
+		width:         timeWidth,
+		cell:          mtimeCell,
+	},
+	"mode": {
+		priority: 3,
+		width:    func(string) int { return 10 },
+		cell:     modeCell,
+	},
+	"owner": {
+		priority:      4,
+		defaultFormat: "user:group",
+		formats:       []string{"user", "group", "user:group"},
+		width:         ownerWidth,
+		cell:          ownerCell,
+	},
+	"target": {
+		priority: 5,
+		width:    func(string) int { return 24 },
+		cell:     targetCell,
+	},
+}
+
+// Set by LoadColumns
+var (
+	listingColumns = defaultColumns
+	columnFormats  = map[string]string{}
+)
+
+// Checks the columns and formats in bfmrc.  Returns the problems found.
+func LoadColumns() []string {
+	problems := []string{}
+
+	listingColumns = defaultColumns
+	if len(config.Columns) > 0 {
+		listingColumns = []string{}
+		for _, name := range config.Columns {
+			if _, found := columnDefs[name]; !found && name != "name" {
+				problems = append(problems, "Unknown column "+name)
+				continue
+			}
+			if Contains(listingColumns, name) {
+				continue
+			}
+			listingColumns = append(listingColumns, name)
+		}
+		if !Contains(listingColumns, "name") {
+			listingColumns = append([]string{"name"}, listingColumns...)
+		}
+	}
+
+	columnFormats = map[string]string{}
+	for name, format := range config.ColumnFormats {
+		def, found := columnDefs[name]
+		if !found {
+			problems = append(problems, "Unknown column "+name+" in column_formats")
+			continue
+		}
+		if def.formats != nil && !Contains(def.formats, format) {
+			problems = append(problems, fmt.Sprintf("Unknown format %q for %s (choose from %s)", format, name, strings.Join(def.formats, ", ")))
+			continue
+		}
+		if name == "mtime" && format != "relative" {
+			if _, err := strftime(time.Now(), format); err != nil {
+				problems = append(problems, "Invalid mtime format: "+err.Error())
+				continue
+			}
+		}
+		columnFormats[name] = format
+	}
+
+	return problems
+}
+
+func columnFormat(name string) string {
+	if format, found := columnFormats[name]; found {
+		return format
+	}
+	return columnDefs[name].defaultFormat
+}
+
+func columnWidth(name string) int {
+	return columnDefs[name].width(columnFormat(name))
+}
+
+// Returns the columns that fit in width, in the order they are shown, and
+// the width left for the name
+func layoutColumns(width int) ([]string, int) {
+	nameWidth := width - 2 - iconWidth() // Cursor and icon
+
+	byPriority := []string{}
+	for _, name := range listingColumns {
+		if name != "name" {
+			byPriority = append(byPriority, name)
+		}
+	}
+	sort.SliceStable(byPriority, func(i, j int) bool {
+		return columnDefs[byPriority[i]].priority < columnDefs[byPriority[j]].priority
+	})
+
+	shown := map[string]bool{"name": true}
+	for _, name := range byPriority {
+		w := columnWidth(name) + 1 // Columns are separated by a space
+		if nameWidth-w < minNameWidth {
+			break
+		}
+		nameWidth -= w
+		shown[name] = true
+	}
+
+	columns := []string{}
+	for _, name := range listingColumns {
+		if shown[name] {
+			columns = append(columns, name)
+		}
+	}
+	return columns, nameWidth
+}
+
+// Returns the cell text padded (or truncated) to width
+func fitCell(text string, width int, alignRight bool) string {
+	if utf8.RuneCountInString(text) > width {
+		text = string([]rune(text)[:width])
+	}
+	if alignRight {
+		return fmt.Sprintf("%*s", width, text)
+	}
+	return fmt.Sprintf("%-*s", width, text)
+}
+
+// Renders column name for the file f in dir
+func renderCell(name string, dir string, f fs.DirEntry, cursorLine bool) string {
+	info, err := f.Info()
+	if err != nil {
+		return strings.Repeat(" ", columnWidth(name))
+	}
+
+	format := columnFormat(name)
+	text, style := columnDefs[name].cell(dir, f, info, format)
+	text = fitCell(text, columnWidth(name), name != "target" && name != "owner")
+
+	if cursorLine {
+		style = style.Copy().Background(cursorBgColor)
+	}
+	return style.Render(text)
+}
+
+// Returns the style for a file modified at mod
+func ageStyle(mod time.Time) lipgloss.Style {
+	age := time.Since(mod)
+	switch {
+	case age.Hours() >= 8640:
+		return yearStyle
+	case age.Hours() >= 720:
+		return monthStyle
+	case age.Hours() >= 168:
+		return weekStyle
+	case age.Hours() >= 24:
+		return dayStyle
+	}
+	return hourStyle
+}
+
+// Returns the style for a file of size b
+func sizeStyle(b int64) lipgloss.Style {
+	switch {
+	case b >= 1<<30:
+		return gByteStyle
+	case b >= 1<<20:
+		return mByteStyle
+	case b >= 1<<10:
+		return kByteStyle
+	}
+	return byteStyle
+}
+
+func sizeWidth(format string) int {
+	if format == "bytes" {
+		return 13
+	}
+	return 5
+}
+
+// Formats size b like GetSize but in powers of 1000
+func siSize(b int64) string {
+	units := []string{"B", "k", "M", "G", "T"}
+	unit := 0
+	for b >= 1000 && unit < len(units)-1 {
+		b /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%4d%s", b, units[unit])
+}
+
+func sizeCell(dir string, f fs.DirEntry, info fs.FileInfo, format string) (string, lipgloss.Style) {
+	b, known := fileSize(dir, f)
+	if !known {
+		// The size of the directory is still being computed
+		return "...", byteStyle
+	}
+	switch format {
+	case "si":
+		return siSize(b), sizeStyle(b)
+	case "bytes":
+		return strconv.FormatInt(b, 10), sizeStyle(b)
+	}
+	return formatSize(b), sizeStyle(b)
+}
+
+// strftime directives and the Go layouts for them
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'j': "002",
+	'Z': "MST",
+	'z': "-0700",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'R': "15:04",
+	'D': "01/02/06",
+}
+
+// Formats t like strftime(3)
+func strftime(t time.Time, format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i == len(format) {
+			return "", fmt.Errorf("%q ends with %%", format)
+		}
+		if format[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		layout, found := strftimeLayouts[format[i]]
+		if !found {
+			return "", fmt.Errorf("unknown directive %%%c in %q", format[i], format)
+		}
+		b.WriteString(t.Format(layout))
+	}
+	return b.String(), nil
+}
+
+func timeWidth(format string) int {
+	if format == "relative" {
+		return 5
+	}
+	// A date with the longest month and day names
+	s, _ := strftime(time.Date(2026, time.September, 30, 23, 59, 59, 0, time.Local), format)
+	return utf8.RuneCountInString(s)
+}
+
+func mtimeCell(dir string, f fs.DirEntry, info fs.FileInfo, format string) (string, lipgloss.Style) {
+	if format == "relative" {
+		return GetModified(f), ageStyle(info.ModTime())
+	}
+	s, _ := strftime(info.ModTime(), format)
+	return s, ageStyle(info.ModTime())
+}
+
+// Returns the mode like ls -l does
+func lsMode(mode fs.FileMode) string {
+	b := []byte("----------")
+	switch {
+	case mode.IsDir():
+		b[0] = 'd'
+	case mode&os.ModeSymlink != 0:
+		b[0] = 'l'
+	case mode&os.ModeNamedPipe != 0:
+		b[0] = 'p'
+	case mode&os.ModeSocket != 0:
+		b[0] = 's'
+	case mode&os.ModeCharDevice != 0:
+		b[0] = 'c'
+	case mode&os.ModeDevice != 0:
+		b[0] = 'b'
+	}
+
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if mode.Perm()&(1<<uint(8-i)) != 0 {
+			b[i+1] = rwx[i]
+		}
+	}
+
+	special := func(i int, set bool, c byte) {
+		if !set {
+			return
+		}
+		if b[i] == 'x' {
+			b[i] = c
+		} else {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	special(3, mode&os.ModeSetuid != 0, 's')
+	special(6, mode&os.ModeSetgid != 0, 's')
+	special(9, mode&os.ModeSticky != 0, 't')
+
+	return string(b)
+}
+
+func modeCell(dir string, f fs.DirEntry, info fs.FileInfo, format string) (string, lipgloss.Style) {
+	return lsMode(info.Mode()), fileDefault
+}
+
+var (
+	userNames  = map[uint32]string{}
+	groupNames = map[uint32]string{}
+)
+
+// Returns the name of the user with uid, or the uid if it has no name
+func userName(uid uint32) string {
+	if name, found := userNames[uid]; found {
+		return name
+	}
+	name := strconv.Itoa(int(uid))
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
+
+// Returns the name of the group with gid, or the gid if it has no name
+func groupName(gid uint32) string {
+	if name, found := groupNames[gid]; found {
+		return name
+	}
+	name := strconv.Itoa(int(gid))
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	groupNames[gid] = name
+	return name
+}
+
+// Returns the owner and group of the file
+func fileOwner(info fs.FileInfo) (string, string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "?", "?"
+	}
+	return userName(stat.Uid), groupName(stat.Gid)
+}
+
+func ownerWidth(format string) int {
+	if format == "user:group" {
+		return 17
+	}
+	return 8
+}
+
+func ownerCell(dir string, f fs.DirEntry, info fs.FileInfo, format string) (string, lipgloss.Style) {
+	owner, group := fileOwner(info)
+	switch format {
+	case "user":
+		return owner, fileDefault
+	case "group":
+		return group, fileDefault
+	}
+	return owner + ":" + group, fileDefault
+}
+
+func targetCell(dir string, f fs.DirEntry, info fs.FileInfo, format string) (string, lipgloss.Style) {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", fileDefault
+	}
+
+	path := filepath.Join(dir, f.Name())
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", fileDefault
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "-> " + target, brokenLink
+	}
+	return "-> " + target, fileDefault
+}
@@ -0,0 +1,532 @@
+// This file contains the directory comparison (compare mode).  A background
+// job walks two directories side by side and lists every path in either of
+// them as only on one side, identical, newer on one side, or different.
+// Missing and newer files can then be copied to the other side in a batch.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	onlyLeft   = iota
+	onlyRight  = iota
+	identical  = iota
+	newerLeft  = iota
+	newerRight = iota
+	differs    = iota // Same age with different contents, or a file and a directory
+)
+
+var compareStatusNames = []string{"only left", "only right", "identical", "newer left", "newer right", "differs"}
+
+// Modification times closer than this are the same, since FAT and some
+// cloud drives only keep times to 2 seconds
+const compareTimeTolerance = 2 * time.Second
+
+// Lines above the entries in compare mode: the header, its padding, and the
+// left/right legend (or a blank line when sizes and times do not fit)
+const compareHeaderLines = 3
+
+type compareEntry struct {
+	path   string      // Relative to both directories
+	left   fs.FileInfo // nil if missing
+	right  fs.FileInfo // nil if missing
+	status int
+}
+
+type compareState struct {
+	left          string
+	right         string
+	hashed        bool // Files of the same size were compared by contents
+	hidden        bool // Hidden files were compared
+	hideIdentical bool
+	entries       []compareEntry
+	cursor        int    // Index into the shown entries
+	message       string // Shown in the header, like what was copied
+}
+
+// Returns the files in dir by name.  A missing directory has no files.
+func readDirInfo(h *jobHandle, dir string) map[string]fs.FileInfo {
+	infos := map[string]fs.FileInfo{}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		h.Log("Cannot read " + dir + ": " + err.Error())
+		return infos
+	}
+	for _, f := range files {
+		if info, err := f.Info(); err == nil {
+			infos[f.Name()] = info
+		}
+	}
+	return infos
+}
+
+// Returns the entries of the trees at left and right.  Directories on both
+// sides are walked, and directories on one side are one entry.
+func compareTrees(h *jobHandle, left string, right string, hidden bool, hashed bool) []compareEntry {
+	entries := []compareEntry{}
+	files := []int{} // Entries of files on both sides, whose status is not known yet
+
+	var walk func(rel string)
+	walk = func(rel string) {
+		if h.Cancelled() {
+			return
+		}
+		lefts := readDirInfo(h, filepath.Join(left, rel))
+		rights := readDirInfo(h, filepath.Join(right, rel))
+
+		names := []string{}
+		for name := range lefts {
+			names = append(names, name)
+		}
+		for name := range rights {
+			if _, found := lefts[name]; !found {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if !hidden && strings.HasPrefix(name, ".") {
+				continue
+			}
+			e := compareEntry{path: filepath.Join(rel, name), left: lefts[name], right: rights[name]}
+			switch {
+			case e.right == nil:
+				e.status = onlyLeft
+			case e.left == nil:
+				e.status = onlyRight
+			case e.left.IsDir() && e.right.IsDir():
+				walk(e.path)
+				continue
+			case e.left.Mode().IsRegular() && e.right.Mode().IsRegular():
+				files = append(files, len(entries))
+			case e.left.Mode().Type() == os.ModeSymlink && e.right.Mode().Type() == os.ModeSymlink:
+				e.status = compareLinks(filepath.Join(left, e.path), filepath.Join(right, e.path))
+			default:
+				e.status = differs
+			}
+			entries = append(entries, e)
+		}
+		h.Status(fmt.Sprintf("compared %d files", len(entries)))
+	}
+	walk("")
+
+	same := make([]bool, len(files))
+	if hashed {
+		runParallel(h, "hashed %d/%d files", len(files), func(i int) {
+			e := entries[files[i]]
+			if e.left.Size() != e.right.Size() {
+				return
+			}
+			leftHash, err := hashPrefix(h, filepath.Join(left, e.path), -1)
+			if err != nil {
+				h.Log("Cannot read " + filepath.Join(left, e.path) + ": " + err.Error())
+				return
+			}
+			rightHash, err := hashPrefix(h, filepath.Join(right, e.path), -1)
+			if err != nil {
+				h.Log("Cannot read " + filepath.Join(right, e.path) + ": " + err.Error())
+				return
+			}
+			same[i] = leftHash == rightHash
+		})
+	}
+
+	for i, index := range files {
+		e := &entries[index]
+		age := e.left.ModTime().Sub(e.right.ModTime())
+		switch {
+		case same[i]:
+			e.status = identical
+		case age > compareTimeTolerance:
+			e.status = newerLeft
+		case age < -compareTimeTolerance:
+			e.status = newerRight
+		case !hashed && e.left.Size() == e.right.Size():
+			e.status = identical
+		default:
+			e.status = differs
+		}
+	}
+
+	return entries
+}
+
+// Symlinks are identical if they point at the same path
+func compareLinks(left string, right string) int {
+	leftTarget, leftErr := os.Readlink(left)
+	rightTarget, rightErr := os.Readlink(right)
+	if leftErr == nil && rightErr == nil && leftTarget == rightTarget {
+		return identical
+	}
+	return differs
+}
+
+// Returns the directories to compare: the two selected directories, or the
+// current tab's directory and the directory of the tab used before it
+func (m *model) compareDirs() (string, string, error) {
+	if len(m.selectedFiles) == 2 {
+		dirs := []string{}
+		for _, sf := range m.selectedFiles {
+			path := filepath.Join(sf.directory, sf.file.Name())
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				dirs = append(dirs, path)
+			}
+		}
+		if len(dirs) == 2 {
+			return dirs[0], dirs[1], nil
+		}
+	}
+
+	for i := len(m.tabHistory) - 1; i >= 0; i-- {
+		tab := m.tabs[m.tabHistory[i]]
+		if m.tabHistory[i] != m.CurrentTabIndex && tab.active && tab.archive == "" && tab.absdir != m.CurrentTab.absdir {
+			return m.CurrentTab.absdir, tab.absdir, nil
+		}
+	}
+	return "", "", errors.New("Select two directories, or open the other directory in another tab, to compare")
+}
+
+// Compares the current tab's directory with another and shows the result in
+// compare mode
+func (m *model) Compare() tea.Cmd {
+	left, right, err := m.compareDirs()
+	if err != nil {
+		m.appendError(err.Error())
+		return nil
+	}
+	m.ClearSelections()
+	m.compare = nil
+	if m.showReady("compare", left+"\n"+right) {
+		return nil
+	}
+	return m.startCompare(left, right, false, m.CurrentTab.showHidden)
+}
+
+func (m *model) startCompare(left string, right string, hashed bool, hidden bool) tea.Cmd {
+	return m.StartJob("compare "+left+" with "+right, func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		entries := compareTrees(h, left, right, hidden, hashed)
+		if h.Cancelled() {
+			return nil, nil
+		}
+		h.Log(fmt.Sprintf("Compared %s", plural(len(entries), "path")))
+
+		return func(m *model) tea.Cmd {
+			m.showWhenReady("compare", left+"\n"+right, compareMode, func(m *model) {
+				state := &compareState{left: left, right: right, hashed: hashed, hidden: hidden, entries: entries}
+				if m.compare != nil && m.compare.left == left && m.compare.right == right {
+					// Compared again, so keep the view as it was
+					state.hideIdentical = m.compare.hideIdentical
+					state.cursor = m.compare.cursor
+					state.message = m.compare.message
+				}
+				m.compare = state
+				m.mode = compareMode
+				m.viewport.SetContent(m.generateContent())
+				m.MoveCompareCursor(0)
+			})
+			return nil
+		}, nil
+	})
+}
+
+// Returns the entries shown, which leaves out identical entries if they
+// are hidden
+func (c *compareState) shown() []compareEntry {
+	if !c.hideIdentical {
+		return c.entries
+	}
+	shown := []compareEntry{}
+	for _, e := range c.entries {
+		if e.status != identical {
+			shown = append(shown, e)
+		}
+	}
+	return shown
+}
+
+func (m *model) MoveCompareCursor(linesDown int) {
+	c := m.compare
+	c.cursor = Max(0, Min(len(c.shown())-1, c.cursor+linesDown))
+
+	line := c.cursor + compareHeaderLines
+	if c.cursor == 0 {
+		m.viewport.SetYOffset(0)
+	} else if line < m.viewport.YOffset+compareHeaderLines {
+		m.viewport.SetYOffset(Max(0, line-compareHeaderLines))
+	}
+	if line > m.viewport.YOffset+m.viewportHeight-1 {
+		m.viewport.SetYOffset(line - m.viewportHeight + 1)
+	}
+}
+
+// Copies the file or directory at src to dst, keeping modes and
+// modification times.  Files are written beside dst and renamed over it, so
+// a cancelled copy does not leave half a file.
+func copyPreserving(h *jobHandle, src string, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if h.Cancelled() {
+			return fs.SkipAll
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type() == os.ModeSymlink:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		case !d.Type().IsRegular():
+			h.Log("Skipped " + p + ", which is not a regular file")
+			return nil
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		tmp := filepath.Join(filepath.Dir(target), ".bfm-copy-"+filepath.Base(target))
+		out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, jobReader{h, in})
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chtimes(tmp, info.ModTime(), info.ModTime())
+		}
+		if err == nil {
+			err = os.Rename(tmp, target)
+		}
+		if err != nil {
+			os.Remove(tmp)
+		}
+		return err
+	})
+}
+
+// Copies the files that are missing or older on the other side, from left
+// to right or from right to left
+func (m *model) CopyCompared(toRight bool) tea.Cmd {
+	c := m.compare
+	from, to := c.left, c.right
+	missing, newer := onlyLeft, newerLeft
+	if !toRight {
+		from, to = c.right, c.left
+		missing, newer = onlyRight, newerRight
+	}
+
+	paths := []string{}
+	for _, e := range c.entries {
+		if e.status == missing || e.status == newer {
+			paths = append(paths, e.path)
+		}
+	}
+	if len(paths) == 0 {
+		c.message = "Nothing to copy to " + to
+		return nil
+	}
+
+	left, right, hashed, hidden := c.left, c.right, c.hashed, c.hidden
+	return m.StartJob("copy "+plural(len(paths), "path")+" to "+to, func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		copied := []string{}
+		problems := []string{}
+		for i, path := range paths {
+			if h.Cancelled() {
+				break
+			}
+			h.Status(fmt.Sprintf("%d/%d", i+1, len(paths)))
+
+			dst := filepath.Join(to, path)
+			if err := copyPreserving(h, filepath.Join(from, path), dst); err != nil {
+				problems = append(problems, path+": "+err.Error())
+				continue
+			}
+			log.Printf("Copied %s to %s", filepath.Join(from, path), dst)
+			copied = append(copied, dst)
+		}
+		h.Log(fmt.Sprintf("Copied %s to %s", plural(len(copied), "path"), to))
+
+		return func(m *model) tea.Cmd {
+			if len(problems) > 0 {
+				m.appendError(formatProblems("Problems copying to "+to, problems))
+			}
+			if len(copied) > 0 {
+				m.emitHook(onOperation, copied, map[string]string{"operation": "copy", "destination": to})
+			}
+			if m.compare != nil {
+				m.compare.message = "Copied " + plural(len(copied), "path") + " to " + to
+			}
+			return m.startCompare(left, right, hashed, hidden)
+		}, nil
+	})
+}
+
+// Returns the size and modification time of a side of an entry
+func compareSide(info fs.FileInfo) string {
+	if info == nil {
+		return fmt.Sprintf("%5s%17s", "-", "")
+	}
+	size := "    -"
+	if !info.IsDir() {
+		size = formatSize(info.Size())
+	}
+	return size + " " + info.ModTime().Format("2006-01-02 15:04")
+}
+
+// Renders the compared entries in compare mode
+func (m *model) generateCompare() string {
+	c := m.compare
+	doc := strings.Builder{}
+
+	counts := make([]int, len(compareStatusNames))
+	for _, e := range c.entries {
+		counts[e.status]++
+	}
+	summary := []string{}
+	for status, count := range counts {
+		if count > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", count, compareStatusNames[status]))
+		}
+	}
+	header := compressCWD(c.left) + "  vs  " + compressCWD(c.right) + "  " + strings.Join(summary, ", ")
+	if c.hashed {
+		header += "  (contents checked)"
+	}
+	if c.message != "" {
+		header += "  " + c.message
+	}
+	doc.WriteString(rSection(header) + "\n")
+
+	// Sizes and times are left out when they do not fit
+	sides := m.termWidth >= 100
+	nameWidth := m.termWidth - 2 - 12
+	if sides {
+		nameWidth -= 2 * 25
+		doc.WriteString(rSubtle(fmt.Sprintf("%*s%-22s   %-22s", 2+12+nameWidth+2, "", "left", "right")) + "\n")
+	} else {
+		doc.WriteString("\n")
+	}
+
+	shown := c.shown()
+	if len(shown) == 0 {
+		doc.WriteString("  No differences found\n")
+		return doc.String()
+	}
+
+	for i, e := range shown {
+		cursorText := "  "
+		style := fileDefault
+		if i == c.cursor {
+			cursorText = "> "
+			style = style.Copy().Background(cursorBgColor)
+		}
+
+		statusStyle := fileDefault
+		switch e.status {
+		case onlyLeft, newerLeft:
+			statusStyle = compareLeft
+		case onlyRight, newerRight:
+			statusStyle = compareRight
+		case differs:
+			statusStyle = failedStyle
+		}
+
+		name := e.path
+		if (e.left != nil && e.left.IsDir()) || (e.right != nil && e.right.IsDir()) {
+			name += string(filepath.Separator)
+		}
+		name = truncateFileName(name, Max(10, nameWidth))
+
+		doc.WriteString(cursorStyle.Render(cursorText))
+		doc.WriteString(statusStyle.Render(fmt.Sprintf("%-12s", compareStatusNames[e.status])))
+		doc.WriteString(style.Render(fmt.Sprintf("%-*s", Max(10, nameWidth), name)))
+		if sides {
+			doc.WriteString("  " + compareSide(e.left) + "   " + compareSide(e.right))
+		}
+		doc.WriteString("\n")
+	}
+
+	return doc.String()
+}
+
+// Handles keys in compare mode
+func (m *model) handleCompareKey(key string) tea.Cmd {
+	c := m.compare
+	c.message = ""
+
+	switch key {
+	case "esc", "q":
+		m.mode = commandMode
+		return refresh()
+	case "j", "down":
+		m.MoveCompareCursor(1)
+	case "k", "up":
+		m.MoveCompareCursor(-1)
+	case "ctrl+d":
+		m.MoveCompareCursor(m.viewportHeight / 2)
+	case "ctrl+u":
+		m.MoveCompareCursor(-m.viewportHeight / 2)
+	case "g":
+		m.MoveCompareCursor(-c.cursor)
+	case "G":
+		m.MoveCompareCursor(len(c.entries))
+	case "i":
+		c.hideIdentical = !c.hideIdentical
+		c.cursor = 0
+		m.MoveCompareCursor(0)
+	case ">":
+		return m.CopyCompared(true)
+	case "<":
+		return m.CopyCompared(false)
+	case "H":
+		return m.startCompare(c.left, c.right, !c.hashed, c.hidden)
+	case "r", "ctrl+l":
+		return m.startCompare(c.left, c.right, c.hashed, c.hidden)
+	case "c":
+		// cd to the hovered file, on the left if it is there
+		shown := c.shown()
+		if len(shown) == 0 {
+			break
+		}
+		e := shown[c.cursor]
+		path := filepath.Join(c.left, e.path)
+		if e.left == nil {
+			path = filepath.Join(c.right, e.path)
+		}
+		m.mode = commandMode
+		return tea.Sequence(cd(filepath.Dir(path)), selectFile(filepath.Base(path)))
+	}
+
+	m.viewport.SetContent(m.generateContent())
+	return nil
+}
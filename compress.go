@@ -0,0 +1,438 @@
+// This file contains the archive and extract commands, which create and
+// extract archives in a background job.  Archives are read by walkArchive,
+// so extract supports the formats that can be browsed.  Go has no bzip2
+// writer, so tar.bz2 can be extracted but not created.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Formats that archive can create
+var archiveCreateFormats = []string{"zip", "tar.gz", "tar"}
+
+const (
+	extractHere     = "Extract here"
+	extractToFolder = "Extract to folder"
+)
+
+// Problems shown in the error message, the rest are in the log panel
+const maxShownProblems = 10
+
+type archivePickedMsg struct {
+	format string
+	paths  []string
+}
+
+type extractPickedMsg struct {
+	where string
+	paths []string
+}
+
+// Returns the directory that contains every path
+func commonRoot(paths []string) string {
+	root := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		dir := filepath.Dir(p)
+		for root != dir && !strings.HasPrefix(dir, root+"/") && root != "/" {
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
+
+// Returns dir/stem+ext, or dir/stem-2+ext, ... if it already exists
+func availablePath(dir string, stem string, ext string) string {
+	p := filepath.Join(dir, stem+ext)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			return p
+		}
+		p = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+	}
+}
+
+// Returns the name of the archive without its extension
+func archiveStem(name string) string {
+	lower := strings.ToLower(name)
+	for _, f := range archiveFormats {
+		if strings.HasSuffix(lower, f.ext) {
+			return name[:len(name)-len(f.ext)]
+		}
+	}
+	return name
+}
+
+// Returns the problems as an error message, with the ones past
+// maxShownProblems left to the log panel
+func formatProblems(title string, problems []string) string {
+	msg := title + ":\n\n" + strings.Join(problems[:Min(len(problems), maxShownProblems)], "\n")
+	if len(problems) > maxShownProblems {
+		msg += fmt.Sprintf("\n... and %d more in the log panel (%s)", len(problems)-maxShownProblems, strings.Join(keys_for("jobs"), ","))
+	}
+	return msg
+}
+
+// Lets the user pick the format of an archive of the selected files (or the
+// hovered file)
+func (m *model) PickArchiveFormat() tea.Cmd {
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		m.appendError("No files to archive")
+		return nil
+	}
+
+	return PickWithFzf("Archive as> ", archiveCreateFormats, func(format string) tea.Msg {
+		return archivePickedMsg{format, paths}
+	})
+}
+
+// Archives paths in the directory of the current tab.  Files are named in
+// the archive by their path from the directory that contains them all.
+func (m *model) ArchiveFiles(format string, paths []string) tea.Cmd {
+	root := commonRoot(paths)
+	stem := filepath.Base(root)
+	if len(paths) == 1 {
+		stem = filepath.Base(paths[0])
+	} else if root == "/" {
+		stem = "archive"
+	}
+	dst := availablePath(m.CurrentTab.absdir, stem, "."+format)
+
+	m.ClearSelections()
+	return m.StartJob("archive "+filepath.Base(dst), func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		count, problems, err := writeArchive(h, dst, format, root, paths)
+		for _, problem := range problems {
+			h.Log(problem)
+		}
+		if err != nil {
+			os.Remove(dst)
+			return refreshFinish, err
+		}
+		h.Log(fmt.Sprintf("Archived %d files to %s", count, dst))
+
+		return func(m *model) tea.Cmd {
+			if len(problems) > 0 {
+				m.appendError(formatProblems("Problems archiving to "+dst, problems))
+			}
+			m.emitHook(onOperation, paths, map[string]string{"operation": "archive", "destination": dst})
+			return refresh()
+		}, nil
+	})
+}
+
+func refreshFinish(m *model) tea.Cmd {
+	return refresh()
+}
+
+// Reads r until the job is cancelled, so a large file does not hold up
+// cancelling
+type jobReader struct {
+	h *jobHandle
+	r io.Reader
+}
+
+func (jr jobReader) Read(p []byte) (int, error) {
+	if jr.h.Cancelled() {
+		return 0, context.Canceled
+	}
+	return jr.r.Read(p)
+}
+
+// Writes paths and everything under them to the archive dst.  Returns the
+// number of files written and the files that could not be read.
+func writeArchive(h *jobHandle, dst string, format string, root string, paths []string) (int, []string, error) {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	var add func(name string, p string, info fs.FileInfo) error
+	var closers []io.Closer
+
+	if format == "zip" {
+		zw := zip.NewWriter(f)
+		closers = append(closers, zw)
+		add = func(name string, p string, info fs.FileInfo) error {
+			hdr, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			hdr.Name = name
+			if info.IsDir() {
+				hdr.Name += "/"
+			} else {
+				hdr.Method = zip.Deflate
+			}
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			return copyMemberContents(h, w, p, info)
+		}
+	} else {
+		var w io.Writer = f
+		if format == "tar.gz" {
+			gz := gzip.NewWriter(f)
+			closers = append(closers, gz)
+			w = gz
+		}
+		tw := tar.NewWriter(w)
+		// The tar writer must be closed before the gzip writer
+		closers = append([]io.Closer{tw}, closers...)
+		add = func(name string, p string, info fs.FileInfo) error {
+			link := ""
+			if info.Mode()&fs.ModeSymlink != 0 {
+				var err error
+				if link, err = os.Readlink(p); err != nil {
+					return err
+				}
+			}
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = name
+			if info.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				return copyMemberContents(h, tw, p, info)
+			}
+			return nil
+		}
+	}
+
+	count := 0
+	problems := []string{}
+	for _, path := range paths {
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if h.Cancelled() {
+				return context.Canceled
+			}
+			if err != nil {
+				problems = append(problems, err.Error())
+				return nil
+			}
+			if p == dst {
+				// The archive may be in a directory it archives
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				problems = append(problems, err.Error())
+				return nil
+			}
+			mode := info.Mode()
+			if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+				problems = append(problems, p+" is not a regular file, directory, or symlink")
+				return nil
+			}
+
+			rel, _ := filepath.Rel(root, p)
+			if err := add(filepath.ToSlash(rel), p, info); err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			count++
+			if count%100 == 0 {
+				h.Status(fmt.Sprintf("%d files", count))
+			}
+			return nil
+		})
+		if err != nil {
+			return count, problems, err
+		}
+	}
+
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			return count, problems, err
+		}
+	}
+	return count, problems, f.Close()
+}
+
+// Writes the contents of the file at p to w.  Zip archives keep the target
+// of a symlink as its contents.
+func copyMemberContents(h *jobHandle, w io.Writer, p string, info fs.FileInfo) error {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, target)
+		return err
+	case !info.Mode().IsRegular():
+		return nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, jobReader{h, f})
+	return err
+}
+
+// Lets the user pick where to extract the selected archives (or the hovered
+// archive)
+func (m *model) PickExtract() tea.Cmd {
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		m.appendError("No archives to extract")
+		return nil
+	}
+	for _, p := range paths {
+		if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() || archiveFormat(p) == "" {
+			m.appendError(filepath.Base(p) + " is not an archive that can be extracted")
+			return nil
+		}
+	}
+
+	return PickWithFzf("Extract> ", []string{extractHere, extractToFolder}, func(where string) tea.Msg {
+		return extractPickedMsg{where, paths}
+	})
+}
+
+// Extracts the archives at paths into the directory of the current tab, or
+// into a folder named after each archive
+func (m *model) ExtractArchives(where string, paths []string) tea.Cmd {
+	dir := m.CurrentTab.absdir
+	name := "extract " + filepath.Base(paths[0])
+	if len(paths) > 1 {
+		name = fmt.Sprintf("extract %d archives", len(paths))
+	}
+
+	m.ClearSelections()
+	return m.StartJob(name, func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		problems := []string{}
+
+		for _, p := range paths {
+			dst := dir
+			if where == extractToFolder {
+				dst = availablePath(dir, archiveStem(filepath.Base(p)), "")
+				if err := os.Mkdir(dst, 0755); err != nil {
+					return refreshFinish, err
+				}
+			}
+
+			count, skipped, err := extractArchive(h, p, dst)
+			for _, problem := range skipped {
+				h.Log(problem)
+			}
+			problems = append(problems, skipped...)
+			if err != nil {
+				return refreshFinish, err
+			}
+			h.Log(fmt.Sprintf("Extracted %d files from %s to %s", count, p, dst))
+		}
+
+		return func(m *model) tea.Cmd {
+			if len(problems) > 0 {
+				m.appendError(formatProblems("Problems extracting", problems))
+			}
+			m.emitHook(onOperation, paths, map[string]string{"operation": "extract", "destination": dir})
+			return refresh()
+		}, nil
+	})
+}
+
+// Returns an error if writing to target, which is under dst, would follow a
+// symlink.  A symlink in an archive could otherwise point the members after
+// it outside of dst.
+func checkExtractPath(dst string, target string) error {
+	rel, err := filepath.Rel(dst, filepath.Dir(target))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("%s is outside of %s", target, dst)
+	}
+	if rel == "." {
+		return nil
+	}
+
+	p := dst
+	for _, part := range strings.Split(rel, "/") {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", p)
+		}
+	}
+	return nil
+}
+
+// Extracts the archive at p into dst without overwriting files.  Returns the
+// number of files extracted and the members that were skipped.
+func extractArchive(h *jobHandle, p string, dst string) (int, []string, error) {
+	count := 0
+	problems := []string{}
+	skip := func(m archiveMember, reason string) {
+		problems = append(problems, fmt.Sprintf("Skipped %s in %s: %s", m.name, filepath.Base(p), reason))
+	}
+
+	err := walkArchive(p, func(m archiveMember, r io.Reader) error {
+		if h.Cancelled() {
+			return context.Canceled
+		}
+		if m.outside {
+			skip(m, "outside of the archive")
+			return nil
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(m.name))
+		if err := checkExtractPath(dst, target); err != nil {
+			skip(m, err.Error())
+			return nil
+		}
+		if info, err := os.Lstat(target); err == nil && !(m.mode.IsDir() && info.IsDir()) {
+			skip(m, "already exists")
+			return nil
+		}
+
+		if m.hardlink {
+			linkname, ok := cleanMemberName(m.linkname)
+			oldname := filepath.Join(dst, filepath.FromSlash(linkname))
+			if err := checkExtractPath(dst, oldname); !ok || err != nil {
+				skip(m, "hard link to "+m.linkname+" is outside of the archive")
+				return nil
+			}
+			if err := os.Link(oldname, target); err != nil {
+				skip(m, err.(*os.LinkError).Err.Error())
+				return nil
+			}
+		} else if err := extractMember(m, jobReader{h, r}, target); err != nil {
+			if h.Cancelled() {
+				return context.Canceled
+			}
+			skip(m, err.Error())
+			return nil
+		}
+
+		count++
+		if count%100 == 0 {
+			h.Status(fmt.Sprintf("%d files", count))
+		}
+		return nil
+	})
+	return count, problems, err
+}
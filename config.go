@@ -30,12 +30,99 @@ type Plugin struct {
 	Help    string `toml:"help"`
 }
 
+// Runs plugin (with optional arguments) in the background when event occurs
+type Hook struct {
+	Event   string `toml:"event"`
+	Command string `toml:"command"`
+}
+
+// Opens files matching any of Glob, Extensions, or Mime with Command.  If
+// the program in Command is not installed, the openers named by Fallback
+// are tried in order.
+type Opener struct {
+	Name        string   `toml:"name"`
+	Glob        []string `toml:"glob"`
+	Extensions  []string `toml:"extensions"`
+	Mime        []string `toml:"mime"`
+	Command     string   `toml:"command"`
+	Interactive bool     `toml:"interactive"`
+	PerFile     bool     `toml:"per_file"`
+	Fallback    []string `toml:"fallback"`
+}
+
+// Colors override the colors of the theme named by Name.  In theme files,
+// Base names the theme that provides the colors the file does not set.
+type Theme struct {
+	Name   string            `toml:"name"`
+	Base   string            `toml:"base"`
+	Colors map[string]string `toml:"colors"`
+}
+
+// Styles files matching any of Glob or Type.  Type is a kind of file (like
+// broken_symlink or setuid) or a file category.  Style is an SGR sequence as
+// used by LS_COLORS (like "01;34"), which the other fields add to.
+type FileStyle struct {
+	Glob          []string `toml:"glob"`
+	Type          []string `toml:"type"`
+	Style         string   `toml:"style"`
+	Fg            string   `toml:"fg"`
+	Bg            string   `toml:"bg"`
+	Bold          bool     `toml:"bold"`
+	Italic        bool     `toml:"italic"`
+	Underline     bool     `toml:"underline"`
+	Faint         bool     `toml:"faint"`
+	Strikethrough bool     `toml:"strikethrough"`
+}
+
+// The sort of new tabs.  By is one of modified, name, size, natural,
+// extension, created, or type, and Case is one of sensitive, insensitive,
+// or locale.
+type SortSettings struct {
+	By        string `toml:"by"`
+	Reverse   bool   `toml:"reverse"`
+	DirsFirst bool   `toml:"dirs_first"`
+	Case      string `toml:"case"`
+}
+
+// Settings for directories matching any of Glob that have no remembered
+// settings.  Unset fields use the defaults.
+type DirSetting struct {
+	Glob      []string `toml:"glob"`
+	Sort      string   `toml:"sort"`
+	Reverse   *bool    `toml:"reverse"`
+	DirsFirst *bool    `toml:"dirs_first"`
+	Case      string   `toml:"case"`
+	Hidden    *bool    `toml:"hidden"`
+}
+
+// The flat listing of flatten.  Depth is how many levels of directories
+// below the current directory are listed (negative for no limit), and files
+// and directories whose names match any of Ignore are skipped.
+type FlattenSettings struct {
+	Depth  int      `toml:"depth"`
+	Ignore []string `toml:"ignore"`
+}
+
 type Config struct {
 	DefaultPlugins     bool              `toml:"default_plugins"`
 	DefaultBindings    bool              `toml:"default_bindings"`
 	Plugins            []Plugin          `toml:"plugins"`
 	Bindings           []Binding         `toml:"bindings"`
 	WdReplacements     []WdReplacement   `toml:"wd_replacements"`
+	Hooks              []Hook            `toml:"hooks"`
+	Openers            []Opener          `toml:"openers"`
+	Theme              Theme             `toml:"theme"`
+	LsColors           bool              `toml:"ls_colors"`
+	FileStyles         []FileStyle       `toml:"file_styles"`
+	Icons              string            `toml:"icons"`
+	IconNames          map[string]string `toml:"icon_names"`
+	IconExtensions     map[string]string `toml:"icon_extensions"`
+	DirSizes           bool              `toml:"dir_sizes"`
+	Columns            []string          `toml:"columns"`
+	ColumnFormats      map[string]string `toml:"column_formats"`
+	Sort               SortSettings      `toml:"sort"`
+	DirSettings        []DirSetting      `toml:"dir_settings"`
+	Flatten            FlattenSettings   `toml:"flatten"`
 }
 
 func LoadConfig() {
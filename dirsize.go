@@ -0,0 +1,241 @@
+// This file contains code for showing the recursive size of directories.
+// When dir_sizes is on, the directories in the listing are walked by
+// background workers and their sizes are sent to Update as they finish.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directories waiting for a worker.  If the queue is full, directories are
+// queued again the next time the listing is drawn.
+const dirSizeQueueLength = 4096
+
+type dirSizeMsg struct {
+	path string
+}
+
+type dirSizeEntry struct {
+	modTime time.Time // Of the directory when the size was computed
+	size    int64
+}
+
+var (
+	dirSizeLock    sync.Mutex
+	dirSizeCache   = map[string]dirSizeEntry{}
+	dirSizePending = map[string]bool{}
+	dirSizeWanted  string // Directory of the listing; sizes outside it are abandoned
+	dirSizeQueue   chan string
+	dirSizeStart   sync.Once
+)
+
+// Set from bfmrc and toggled with toggle_dir_sizes
+var showDirSizes bool
+
+func startDirSizeWorkers() {
+	dirSizeQueue = make(chan string, dirSizeQueueLength)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go dirSizeWorker()
+	}
+}
+
+func dirSizeWorker() {
+	for path := range dirSizeQueue {
+		size, modTime, ok := walkDirSize(path)
+
+		dirSizeLock.Lock()
+		delete(dirSizePending, path)
+		if ok {
+			dirSizeCache[path] = dirSizeEntry{modTime, size}
+		}
+		dirSizeLock.Unlock()
+
+		if ok {
+			send(dirSizeMsg{path})
+		}
+	}
+}
+
+// Returns true if the listing may still show the directory at path, which
+// is nested when the listing is a tree
+func dirSizeIsWanted(path string) bool {
+	dirSizeLock.Lock()
+	defer dirSizeLock.Unlock()
+	dir := filepath.Dir(path)
+	return dir == dirSizeWanted || (dirSizeWanted != "" && strings.HasPrefix(dir, dirSizeWanted+string(filepath.Separator)))
+}
+
+// Adds up the sizes of all files under path without following symlinks.
+// Returns false if the listing moved on before the walk finished.
+func walkDirSize(path string) (int64, time.Time, bool) {
+	var modTime time.Time
+	var size int64
+	count := 0
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip what cannot be read, like du does
+			if d != nil && d.IsDir() && p != path {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		count++
+		if count%1000 == 0 && !dirSizeIsWanted(path) {
+			return fs.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if p == path {
+			modTime = info.ModTime()
+			return nil
+		}
+		if !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error computing size of %s: %s", path, err)
+	}
+
+	if !dirSizeIsWanted(path) {
+		log.Printf("Abandoned size of %s", path)
+		return 0, modTime, false
+	}
+	return size, modTime, true
+}
+
+// Returns the recursive size of the directory f in dir if it is known
+func cachedDirSize(dir string, f fs.DirEntry) (int64, bool) {
+	info, err := f.Info()
+	if err != nil {
+		return 0, false
+	}
+
+	dirSizeLock.Lock()
+	defer dirSizeLock.Unlock()
+	entry, found := dirSizeCache[filepath.Join(dir, f.Name())]
+	if !found || !entry.modTime.Equal(info.ModTime()) {
+		return 0, false
+	}
+	return entry.size, true
+}
+
+// Returns the size of the file f in dir.  Directories have their recursive
+// size when dir_sizes is on and it has been computed.
+func fileSize(dir string, f fs.DirEntry) (int64, bool) {
+	if e, ok := f.(*archiveEntry); ok && showDirSizes && e.IsDir() {
+		// Archives are indexed with the sizes of their directories
+		return e.total, true
+	}
+	if showDirSizes && f.IsDir() {
+		return cachedDirSize(dir, f)
+	}
+	info, err := f.Info()
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// Queues the directories in the current tab whose size is not known
+func (m *model) requestDirSizes() {
+	if !showDirSizes {
+		return
+	}
+	dirSizeStart.Do(startDirSizeWorkers)
+
+	ct := m.CurrentTab
+	if ct.archive != "" {
+		return
+	}
+
+	dirSizeLock.Lock()
+	dirSizeWanted = ct.absdir
+	dirSizeLock.Unlock()
+
+	for dir, files := range ct.listedDirs() {
+		for _, f := range files {
+			if !f.IsDir() {
+				continue
+			}
+			if _, known := cachedDirSize(dir, f); known {
+				continue
+			}
+
+			path := filepath.Join(dir, f.Name())
+			dirSizeLock.Lock()
+			if dirSizePending[path] {
+				dirSizeLock.Unlock()
+				continue
+			}
+			select {
+			case dirSizeQueue <- path:
+				dirSizePending[path] = true
+			default:
+			}
+			dirSizeLock.Unlock()
+		}
+	}
+}
+
+// Returns the number of directories in the current tab still being sized
+func (m *model) pendingDirSizes() int {
+	dirs := m.CurrentTab.listedDirs()
+	count := 0
+
+	dirSizeLock.Lock()
+	defer dirSizeLock.Unlock()
+	for path := range dirSizePending {
+		if _, listed := dirs[filepath.Dir(path)]; listed {
+			count++
+		}
+	}
+	return count
+}
+
+// Called by Update when the size of a directory is known
+func (m *model) handleDirSize(msg dirSizeMsg) {
+	ct := m.CurrentTab
+	if _, listed := ct.listedDirs()[filepath.Dir(msg.path)]; !listed || (m.mode != commandMode && m.mode != filterMode) {
+		return
+	}
+
+	if ct.sort == sizeSort {
+		ct.ReRunFilter()
+	}
+	m.viewport.SetContent(m.generateContent())
+	m.scrollToCursor()
+}
+
+func (m *model) ToggleDirSizes() {
+	showDirSizes = !showDirSizes
+	if !showDirSizes {
+		dirSizeLock.Lock()
+		dirSizeWanted = ""
+		dirSizeLock.Unlock()
+	}
+	m.CurrentTab.ReRunFilter()
+	m.viewport.SetContent(m.generateContent())
+}
+
+func (m *model) renderDirSizeStatus() string {
+	pending := m.pendingDirSizes()
+	if pending == 0 {
+		return ""
+	}
+	return rStats(fmt.Sprintf("DU:%d", pending))
+}
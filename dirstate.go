@@ -0,0 +1,212 @@
+// This file contains the view settings of directories.  The sort, hidden
+// files toggle, and hovered file of each directory are remembered in
+// ~/.local/state/bfm/dirs.json, and [[dir_settings]] in bfmrc provides
+// settings for directories that have none.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Directories used least recently are forgotten past this
+const dirStateLimit = 1000
+
+type dirState struct {
+	Sort      string    `json:"sort"`
+	Reverse   bool      `json:"reverse"`
+	DirsFirst bool      `json:"dirs_first"`
+	Case      string    `json:"case"`
+	Hidden    bool      `json:"hidden"`
+	Cursor    string    `json:"cursor"` // Name of the hovered file
+	Used      time.Time `json:"used"`
+}
+
+var dirStates = map[string]dirState{}
+
+// [[dir_settings]] with ~ expanded, set by LoadDirSettings
+var dirSettings []DirSetting
+
+func dirStatePath() string {
+	return filepath.Join(home, ".local/state/bfm/dirs.json")
+}
+
+// Reads the remembered settings of directories
+func LoadDirStates() {
+	data, err := os.ReadFile(dirStatePath())
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading %s: %s", dirStatePath(), err)
+		return
+	}
+	if err := json.Unmarshal(data, &dirStates); err != nil {
+		log.Printf("Error parsing %s: %s", dirStatePath(), err)
+		dirStates = map[string]dirState{}
+	}
+}
+
+// Writes the remembered settings of the directories used most recently
+func SaveDirStates() {
+	if len(dirStates) > dirStateLimit {
+		dirs := []string{}
+		for dir := range dirStates {
+			dirs = append(dirs, dir)
+		}
+		sort.Slice(dirs, func(i, j int) bool {
+			return dirStates[dirs[i]].Used.After(dirStates[dirs[j]].Used)
+		})
+		for _, dir := range dirs[dirStateLimit:] {
+			delete(dirStates, dir)
+		}
+	}
+
+	data, err := json.MarshalIndent(dirStates, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding directory settings: %s", err)
+		return
+	}
+
+	path := dirStatePath()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	tmppath := path + ".tmp"
+	if err := os.WriteFile(tmppath, data, 0644); err != nil {
+		log.Printf("Error writing %s: %s", tmppath, err)
+		return
+	}
+	if err := os.Rename(tmppath, path); err != nil {
+		log.Printf("Error writing %s: %s", path, err)
+	}
+}
+
+// Checks [[dir_settings]] in bfmrc.  Returns the problems found.
+func LoadDirSettings() []string {
+	problems := []string{}
+
+	dirSettings = []DirSetting{}
+	for _, setting := range config.DirSettings {
+		if len(setting.Glob) == 0 {
+			problems = append(problems, "dir_settings without a glob")
+			continue
+		}
+		if _, found := lookupName(sortNames, setting.Sort); setting.Sort != "" && !found {
+			problems = append(problems, "Unknown sort "+setting.Sort+" in dir_settings")
+			continue
+		}
+		if _, found := lookupName(caseNames, setting.Case); setting.Case != "" && !found {
+			problems = append(problems, "Unknown sort case "+setting.Case+" in dir_settings")
+			continue
+		}
+
+		globs := []string{}
+		for _, glob := range setting.Glob {
+			if glob == "~" || strings.HasPrefix(glob, "~/") {
+				glob = home + glob[1:]
+			}
+			if _, err := filepath.Match(strings.TrimSuffix(glob, "/**"), ""); err != nil {
+				problems = append(problems, "Invalid glob "+glob+" in dir_settings")
+				continue
+			}
+			globs = append(globs, glob)
+		}
+		setting.Glob = globs
+		dirSettings = append(dirSettings, setting)
+	}
+
+	return problems
+}
+
+// Returns true if the glob matches dir.  A glob ending with /** also matches
+// every directory under it.
+func dirGlobMatches(glob string, dir string) bool {
+	if prefix, found := strings.CutSuffix(glob, "/**"); found {
+		for d := dir; ; d = filepath.Dir(d) {
+			if matched, _ := filepath.Match(prefix, d); matched {
+				return true
+			}
+			if d == filepath.Dir(d) {
+				return false
+			}
+		}
+	}
+	matched, _ := filepath.Match(glob, dir)
+	return matched
+}
+
+// Returns the first of [[dir_settings]] that matches dir
+func dirSettingFor(dir string) (DirSetting, bool) {
+	for _, setting := range dirSettings {
+		for _, glob := range setting.Glob {
+			if dirGlobMatches(glob, dir) {
+				return setting, true
+			}
+		}
+	}
+	return DirSetting{}, false
+}
+
+// Remembers the settings and hovered file of the tab's directory
+func (td *tabData) rememberDir() {
+	if td.absdir == "" {
+		return
+	}
+
+	state := dirState{
+		Sort:      sortNames[td.sort],
+		Reverse:   td.sortReverse,
+		DirsFirst: td.dirsFirst,
+		Case:      caseNames[td.sortCase],
+		Hidden:    td.showHidden,
+		Used:      time.Now(),
+	}
+	if td.cursor >= 0 && td.cursor < len(td.filteredFiles) {
+		state.Cursor = td.filteredFiles[td.cursor].Name()
+	} else {
+		// Closed tabs have no files, so keep what was hovered before
+		state.Cursor = dirStates[td.absdir].Cursor
+	}
+	dirStates[td.absdir] = state
+}
+
+// Sets the tab's settings for dir, which it is about to list.  Directories
+// without remembered settings use [[dir_settings]], then the [sort] defaults,
+// and keep the tab's hidden files toggle.  Returns the file to hover, if any.
+func (td *tabData) restoreDir(dir string) string {
+	if state, found := dirStates[dir]; found {
+		td.sort, _ = lookupName(sortNames, state.Sort)
+		td.sortReverse = state.Reverse
+		td.dirsFirst = state.DirsFirst
+		td.sortCase, _ = lookupName(caseNames, state.Case)
+		td.showHidden = state.Hidden
+		return state.Cursor
+	}
+
+	td.setDefaultSort()
+	setting, found := dirSettingFor(dir)
+	if !found {
+		return ""
+	}
+	if setting.Sort != "" {
+		td.sort, _ = lookupName(sortNames, setting.Sort)
+	}
+	if setting.Case != "" {
+		td.sortCase, _ = lookupName(caseNames, setting.Case)
+	}
+	if setting.Reverse != nil {
+		td.sortReverse = *setting.Reverse
+	}
+	if setting.DirsFirst != nil {
+		td.dirsFirst = *setting.DirsFirst
+	}
+	if setting.Hidden != nil {
+		td.showHidden = *setting.Hidden
+	}
+	return ""
+}
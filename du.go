@@ -0,0 +1,472 @@
+// This file contains the disk usage analyzer (du mode), which works like
+// ncdu.  A tree is scanned in parallel by a background job and shown one
+// directory at a time with the largest children first.  Scans may be
+// exported to JSON (also with bfm --du-export) and loaded again later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Identifies JSON files exported by bfm
+const duFormat = "bfm-du"
+
+// Lines above the children in du mode
+const duHeaderLines = 2
+
+// How often the scan updates its status in the footer
+const duStatusInterval = 200 * time.Millisecond
+
+type duNode struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Dir      bool      `json:"dir,omitempty"`
+	Children []*duNode `json:"children,omitempty"`
+	parent   *duNode
+}
+
+type duExport struct {
+	Format  string    `json:"format"`
+	Root    string    `json:"root"`
+	Scanned time.Time `json:"scanned"`
+	Tree    *duNode   `json:"tree"`
+}
+
+type duState struct {
+	root     *duNode // Its name is the full path of the scanned directory
+	current  *duNode
+	cursor   int
+	scanned  time.Time
+	imported bool   // Loaded from JSON, so the files may not be on this machine
+	message  string // Shown in the header, like where the scan was exported
+}
+
+type duScanner struct {
+	h          *jobHandle
+	sem        chan struct{} // Limits the goroutines reading directories
+	files      atomic.Int64
+	lastStatus atomic.Int64
+}
+
+func (s *duScanner) progress() {
+	files := s.files.Add(1)
+	now := time.Now().UnixNano()
+	last := s.lastStatus.Load()
+	if now-last > int64(duStatusInterval) && s.lastStatus.CompareAndSwap(last, now) {
+		s.h.Status(fmt.Sprintf("%d files", files))
+	}
+}
+
+// Scans the directory at path.  Subdirectories are scanned in other
+// goroutines while there are free slots.
+func (s *duScanner) scan(path string, name string) *duNode {
+	node := &duNode{Name: name, Dir: true}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		s.h.Log("Cannot read " + path + ": " + err.Error())
+		return node
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	add := func(child *duNode) {
+		lock.Lock()
+		node.Children = append(node.Children, child)
+		lock.Unlock()
+	}
+
+	for _, e := range entries {
+		if s.h.Cancelled() {
+			break
+		}
+
+		// Symlinks are not followed, like du does
+		if e.IsDir() {
+			childPath := filepath.Join(path, e.Name())
+			select {
+			case s.sem <- struct{}{}:
+				wg.Add(1)
+				go func(childPath, childName string) {
+					defer wg.Done()
+					defer func() { <-s.sem }()
+					add(s.scan(childPath, childName))
+				}(childPath, e.Name())
+			default:
+				add(s.scan(childPath, e.Name()))
+			}
+			continue
+		}
+
+		var size int64
+		if info, err := e.Info(); err == nil {
+			size = info.Size()
+		}
+		add(&duNode{Name: e.Name(), Size: size})
+		s.progress()
+	}
+	wg.Wait()
+
+	for _, child := range node.Children {
+		node.Size += child.Size
+	}
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return node.Children[i].Size > node.Children[j].Size
+	})
+	return node
+}
+
+// Sets the parent of every node under node
+func (node *duNode) link() {
+	for _, child := range node.Children {
+		child.parent = node
+		child.link()
+	}
+}
+
+// Returns the full path of the node
+func (node *duNode) path() string {
+	if node.parent == nil {
+		return node.Name
+	}
+	return filepath.Join(node.parent.path(), node.Name)
+}
+
+func scanDu(h *jobHandle, root string) *duNode {
+	s := &duScanner{h: h, sem: make(chan struct{}, runtime.NumCPU()*2)}
+	tree := s.scan(root, root)
+	tree.link()
+	h.Log(fmt.Sprintf("Scanned %d files (%s) in %s", s.files.Load(), strings.TrimSpace(formatSize(tree.Size)), root))
+	return tree
+}
+
+// Scans dir in the background and shows it in du mode
+func (m *model) StartDu(dir string) tea.Cmd {
+	return m.StartJob("du "+dir, func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		tree := scanDu(h, dir)
+		if h.Cancelled() {
+			return nil, nil
+		}
+		du := &duState{root: tree, current: tree, scanned: time.Now()}
+		return func(m *model) tea.Cmd {
+			m.showWhenReady("du", dir, duMode, func(m *model) { m.showDu(du) })
+			return nil
+		}, nil
+	})
+}
+
+func (m *model) showDu(du *duState) {
+	m.du = du
+	m.mode = duMode
+	m.viewport.SetContent(m.generateContent())
+	m.viewport.GotoTop()
+}
+
+// Returns true if the file at path was exported by bfm --du-export or the
+// export command of du mode
+func isDuExport(path string) bool {
+	if !strings.HasSuffix(path, ".json") {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// Only the beginning needs to be read to find the format
+	head := make([]byte, 64)
+	n, _ := f.Read(head)
+	return strings.Contains(string(head[:n]), `"format":"`+duFormat+`"`)
+}
+
+func loadDu(path string) (*duState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var export duExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	if export.Format != duFormat || export.Tree == nil {
+		return nil, fmt.Errorf("%s is not a du export", path)
+	}
+
+	export.Tree.Name = export.Root
+	export.Tree.link()
+	return &duState{root: export.Tree, current: export.Tree, scanned: export.Scanned, imported: true}, nil
+}
+
+func writeDu(path string, root *duNode, scanned time.Time) error {
+	data, err := json.Marshal(duExport{duFormat, root.Name, scanned, root})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Scans or loads disk usage.  A hovered du export is loaded, otherwise the
+// current directory is scanned.
+func (m *model) Du() tea.Cmd {
+	ct := m.CurrentTab
+	if ct.cursor >= 0 && ct.cursor < len(ct.filteredFiles) {
+		path := filepath.Join(ct.absdir, m.getHoveredDirEntry().Name())
+		if isDuExport(path) {
+			du, err := loadDu(path)
+			if err != nil {
+				m.appendError("Error loading " + path + ": " + err.Error())
+				return nil
+			}
+			m.showDu(du)
+			return nil
+		}
+	}
+	if m.showReady("du", ct.absdir) {
+		return nil
+	}
+	return m.StartDu(ct.absdir)
+}
+
+// Writes the scan to the directory of the current tab
+func (m *model) ExportDu() {
+	du := m.du
+	name := fmt.Sprintf("bfm-du-%s-%s.json", filepath.Base(du.root.Name), du.scanned.Format("20060102-150405"))
+	path := filepath.Join(m.CurrentTab.absdir, name)
+
+	if err := writeDu(path, du.root, du.scanned); err != nil {
+		m.appendError("Error exporting disk usage: " + err.Error())
+		return
+	}
+	log.Printf("Exported disk usage of %s to %s", du.root.Name, path)
+	du.message = "Exported to " + path
+}
+
+// Runs bfm --du-export DIR FILE, which scans without the TUI so servers can
+// be analyzed elsewhere
+func RunDuExport(dir string, path string) int {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	h := &jobHandle{0, context.Background()}
+	tree := scanDu(h, dir)
+	if err := writeDu(path, tree, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func (m *model) duHovered() *duNode {
+	du := m.du
+	if du.cursor < 0 || du.cursor >= len(du.current.Children) {
+		return nil
+	}
+	return du.current.Children[du.cursor]
+}
+
+func (m *model) MoveDuCursor(linesDown int) {
+	du := m.du
+	du.cursor = Max(0, Min(len(du.current.Children)-1, du.cursor+linesDown))
+
+	line := du.cursor + duHeaderLines
+	if line < m.viewport.YOffset+duHeaderLines {
+		m.viewport.SetYOffset(Max(0, line-duHeaderLines))
+	}
+	if line > m.viewport.YOffset+m.viewportHeight-1 {
+		m.viewport.SetYOffset(line - m.viewportHeight + 1)
+	}
+}
+
+// Shows the hovered directory
+func (m *model) DuDown() {
+	node := m.duHovered()
+	if node == nil || !node.Dir {
+		return
+	}
+	m.du.current = node
+	m.du.cursor = 0
+	m.viewport.GotoTop()
+}
+
+// Shows the parent directory with the cursor on the directory that was shown
+func (m *model) DuUp() {
+	du := m.du
+	if du.current.parent == nil {
+		return
+	}
+	child := du.current
+	du.current = du.current.parent
+	du.cursor = 0
+	for i, c := range du.current.Children {
+		if c == child {
+			du.cursor = i
+		}
+	}
+	m.viewport.GotoTop()
+	m.MoveDuCursor(0)
+}
+
+// Trashes or removes the hovered file and updates the totals
+func (m *model) DuDelete(trash bool) {
+	du := m.du
+	node := m.duHovered()
+	if node == nil {
+		return
+	}
+	if du.imported {
+		m.appendError("Files cannot be removed from a loaded scan")
+		return
+	}
+
+	path := node.path()
+	operation := "remove"
+	if trash {
+		operation = "trash"
+		info := RunBlock("trash", path)
+		if info.err != nil {
+			m.appendRunError("Error trashing file", info)
+			return
+		}
+	} else {
+		log.Printf("Removing %s", path)
+		if err := os.RemoveAll(path); err != nil {
+			m.appendError("Error removing " + path + ": " + err.Error())
+			return
+		}
+	}
+	m.emitHook(onOperation, []string{path}, map[string]string{"operation": operation})
+
+	du.current.Children = append(du.current.Children[:du.cursor], du.current.Children[du.cursor+1:]...)
+	for p := du.current; p != nil; p = p.parent {
+		p.Size -= node.Size
+	}
+	du.cursor = Min(du.cursor, len(du.current.Children)-1)
+	du.message = "Removed " + path
+	if trash {
+		du.message = "Trashed " + path
+	}
+}
+
+func renderDuBar(fraction float64, width int) string {
+	filled := int(fraction*float64(width) + 0.5)
+	filled = Max(0, Min(width, filled))
+	return duBar.Render(strings.Repeat("█", filled)) + rSubtle(strings.Repeat(" ", width-filled))
+}
+
+// Renders the children of the directory being shown in du mode
+func (m *model) generateDu() string {
+	du := m.du
+	doc := strings.Builder{}
+
+	header := fmt.Sprintf("%s  %s", du.current.path(), strings.TrimSpace(formatSize(du.current.Size)))
+	if du.imported {
+		header += "  (loaded scan from " + du.scanned.Format("2006-01-02 15:04") + ")"
+	}
+	if du.message != "" {
+		header += "  " + du.message
+	}
+	doc.WriteString(rSection(header) + "\n")
+
+	if len(du.current.Children) == 0 {
+		doc.WriteString("  Empty directory\n")
+		return doc.String()
+	}
+
+	barWidth := Max(5, Min(30, m.termWidth/5))
+	for i, node := range du.current.Children {
+		cursorText := "  "
+		if i == du.cursor {
+			cursorText = "> "
+		}
+
+		fraction := 0.0
+		if du.current.Size > 0 {
+			fraction = float64(node.Size) / float64(du.current.Size)
+		}
+
+		name := node.Name
+		if node.Dir {
+			name += "/"
+		}
+
+		style := fileDefault
+		if node.Dir {
+			style = directory
+		}
+		sizeText := sizeStyle(node.Size).Render(formatSize(node.Size))
+		if i == du.cursor {
+			style = style.Copy().Background(cursorBgColor)
+		}
+
+		doc.WriteString(cursorStyle.Render(cursorText))
+		doc.WriteString(sizeText + " ")
+		doc.WriteString(fmt.Sprintf("%5.1f%% ", fraction*100))
+		doc.WriteString(renderDuBar(fraction, barWidth) + " ")
+		doc.WriteString(style.Render(truncateFileName(name, Max(10, m.termWidth-barWidth-16))))
+		doc.WriteString("\n")
+	}
+
+	return doc.String()
+}
+
+// Handles keys in du mode
+func (m *model) handleDuKey(key string) tea.Cmd {
+	du := m.du
+	du.message = ""
+
+	switch key {
+	case "esc", "q":
+		m.mode = commandMode
+		return refresh()
+	case "j", "down":
+		m.MoveDuCursor(1)
+	case "k", "up":
+		m.MoveDuCursor(-1)
+	case "ctrl+d":
+		m.MoveDuCursor(m.viewportHeight / 2)
+	case "ctrl+u":
+		m.MoveDuCursor(-m.viewportHeight / 2)
+	case "g":
+		m.MoveDuCursor(-du.cursor)
+	case "G":
+		m.MoveDuCursor(len(du.current.Children))
+	case "l", "enter", "right":
+		m.DuDown()
+	case "h", "-", "backspace", "left":
+		m.DuUp()
+	case "T":
+		m.DuDelete(true)
+	case "X":
+		m.DuDelete(false)
+	case "E":
+		m.ExportDu()
+	case "c":
+		// cd to the directory being shown
+		if !du.imported {
+			m.mode = commandMode
+			return cd(du.current.path())
+		}
+	}
+
+	m.viewport.SetContent(m.generateContent())
+	return nil
+}
@@ -0,0 +1,540 @@
+// This file contains the duplicate finder (dups mode).  A background job
+// scans the tree of the current tab and narrows files down to duplicates by
+// size, then by a hash of their beginning, then by a hash of everything.
+// Duplicates are shown in groups, and all but one file of a group can be
+// trashed or replaced with hard links to it.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Bytes hashed to rule out files of the same size quickly
+const dupPartialSize = 64 * 1024
+
+// Lines above the groups in dups mode
+const dupHeaderLines = 2
+
+type dupFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	links   []string // Other names of the same file, which go with it
+}
+
+type dupGroup struct {
+	size  int64
+	files []dupFile // Oldest first
+	keep  int       // Index of the file that is kept
+}
+
+type dupState struct {
+	root    string
+	groups  []*dupGroup
+	cursor  int    // Index of the hovered file, counting the files of every group
+	message string // Shown in the header, like what was trashed
+}
+
+// Files are the same if they have the same device and inode
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// Returns the sha256 of the first limit bytes of the file at path, or of
+// all of it if limit is negative
+func hashPrefix(h *jobHandle, path string, limit int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader = jobReader{h, f}
+	if limit >= 0 {
+		r = io.LimitReader(r, limit)
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Splits each group into the files that have the same hash.  Files that
+// cannot be read are logged and left out.
+func splitByHash(h *jobHandle, status string, groups [][]dupFile, limit int64) [][]dupFile {
+	type candidate struct {
+		group int
+		file  dupFile
+		hash  string
+		err   error
+	}
+	candidates := []candidate{}
+	for i, group := range groups {
+		for _, f := range group {
+			candidates = append(candidates, candidate{group: i, file: f})
+		}
+	}
+
+	runParallel(h, status, len(candidates), func(i int) {
+		c := &candidates[i]
+		c.hash, c.err = hashPrefix(h, c.file.path, limit)
+	})
+
+	byHash := map[string][]dupFile{}
+	keys := []string{}
+	for _, c := range candidates {
+		if c.err != nil {
+			h.Log("Cannot read " + c.file.path + ": " + c.err.Error())
+			continue
+		}
+		key := fmt.Sprintf("%d %s", c.group, c.hash)
+		if _, found := byHash[key]; !found {
+			keys = append(keys, key)
+		}
+		byHash[key] = append(byHash[key], c.file)
+	}
+
+	split := [][]dupFile{}
+	for _, key := range keys {
+		if len(byHash[key]) > 1 {
+			split = append(split, byHash[key])
+		}
+	}
+	return split
+}
+
+// Returns the groups of duplicate files under root.  Empty files and
+// symlinks are not counted, and hard links to the same file are one file.
+func findDuplicates(h *jobHandle, root string, hidden bool) []*dupGroup {
+	bySize := map[int64][]dupFile{}
+	seen := map[fileID]string{} // First name of each file
+	links := map[string][]string{}
+	scanned := 0
+
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if h.Cancelled() {
+			return fs.SkipAll
+		}
+		if err != nil {
+			h.Log("Cannot read " + p + ": " + err.Error())
+			return nil
+		}
+		if !hidden && p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() == 0 {
+			return nil
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			id := fileID{uint64(stat.Dev), uint64(stat.Ino)}
+			if first, found := seen[id]; found {
+				links[first] = append(links[first], p)
+				return nil
+			}
+			seen[id] = p
+		}
+
+		bySize[info.Size()] = append(bySize[info.Size()], dupFile{path: p, size: info.Size(), modTime: info.ModTime()})
+		scanned++
+		if scanned%100 == 0 {
+			h.Status(fmt.Sprintf("scanned %d files", scanned))
+		}
+		return nil
+	})
+	h.Log(fmt.Sprintf("Scanned %d files in %s", scanned, root))
+
+	candidates := [][]dupFile{}
+	for _, files := range bySize {
+		if len(files) > 1 {
+			candidates = append(candidates, files)
+		}
+	}
+
+	// Small files are hashed completely by the first pass
+	candidates = splitByHash(h, "partial hash %d/%d files", candidates, dupPartialSize)
+	small, large := [][]dupFile{}, [][]dupFile{}
+	for _, files := range candidates {
+		if files[0].size <= dupPartialSize {
+			small = append(small, files)
+		} else {
+			large = append(large, files)
+		}
+	}
+	large = splitByHash(h, "full hash %d/%d files", large, -1)
+
+	groups := []*dupGroup{}
+	for _, files := range append(small, large...) {
+		for i := range files {
+			files[i].links = links[files[i].path]
+		}
+		sort.Slice(files, func(i, j int) bool {
+			if !files[i].modTime.Equal(files[j].modTime) {
+				return files[i].modTime.Before(files[j].modTime)
+			}
+			return files[i].path < files[j].path
+		})
+		groups = append(groups, &dupGroup{size: files[0].size, files: files})
+	}
+
+	// Groups that waste the most space come first
+	sort.Slice(groups, func(i, j int) bool {
+		wi, wj := groups[i].wasted(), groups[j].wasted()
+		if wi != wj {
+			return wi > wj
+		}
+		return groups[i].files[0].path < groups[j].files[0].path
+	})
+	return groups
+}
+
+// Returns the bytes used by the files that are not kept
+func (g *dupGroup) wasted() int64 {
+	return g.size * int64(len(g.files)-1)
+}
+
+// Scans the current tab's directory for duplicates and shows them in dups
+// mode
+func (m *model) FindDuplicates() tea.Cmd {
+	root := m.CurrentTab.absdir
+	hidden := m.CurrentTab.showHidden
+	if m.showReady("find_duplicates", root) {
+		return nil
+	}
+
+	return m.StartJob("find duplicates in "+root, func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		groups := findDuplicates(h, root, hidden)
+		if h.Cancelled() {
+			return nil, nil
+		}
+		h.Log(fmt.Sprintf("Found %d groups of duplicates", len(groups)))
+
+		return func(m *model) tea.Cmd {
+			m.showWhenReady("find_duplicates", root, dupsMode, func(m *model) {
+				m.dups = &dupState{root: root, groups: groups}
+				m.mode = dupsMode
+				m.viewport.SetContent(m.generateContent())
+				m.viewport.GotoTop()
+			})
+			return nil
+		}, nil
+	})
+}
+
+// Returns the hovered group and the index of the hovered file in it
+func (m *model) dupHovered() (*dupGroup, int) {
+	i := m.dups.cursor
+	for _, g := range m.dups.groups {
+		if i < len(g.files) {
+			return g, i
+		}
+		i -= len(g.files)
+	}
+	return nil, 0
+}
+
+func (m *model) dupFileCount() int {
+	count := 0
+	for _, g := range m.dups.groups {
+		count += len(g.files)
+	}
+	return count
+}
+
+// Returns the line of the hovered file, counting the line above each group
+func (m *model) dupCursorLine() int {
+	line := dupHeaderLines
+	i := m.dups.cursor
+	for _, g := range m.dups.groups {
+		line++
+		if i < len(g.files) {
+			return line + i
+		}
+		line += len(g.files)
+		i -= len(g.files)
+	}
+	return line
+}
+
+func (m *model) MoveDupCursor(linesDown int) {
+	dups := m.dups
+	dups.cursor = Max(0, Min(m.dupFileCount()-1, dups.cursor+linesDown))
+
+	// Keep the line above the first file of a group in view
+	line := m.dupCursorLine()
+	if _, i := m.dupHovered(); i == 0 {
+		line--
+	}
+	if line < m.viewport.YOffset+dupHeaderLines {
+		m.viewport.SetYOffset(Max(0, line-dupHeaderLines))
+	}
+	line = m.dupCursorLine()
+	if line > m.viewport.YOffset+m.viewportHeight-1 {
+		m.viewport.SetYOffset(line - m.viewportHeight + 1)
+	}
+}
+
+// Returns the groups acted on: every group, or the hovered group
+func (m *model) dupTargets(all bool) []*dupGroup {
+	if all {
+		return m.dups.groups
+	}
+	if g, _ := m.dupHovered(); g != nil {
+		return []*dupGroup{g}
+	}
+	return nil
+}
+
+// Forgets the files that were acted on, and groups with one file left
+func (m *model) forgetDups(done map[string]bool) {
+	dups := m.dups
+	groups := []*dupGroup{}
+	for _, g := range dups.groups {
+		kept := g.files[g.keep]
+		files := []dupFile{}
+		for _, f := range g.files {
+			if !done[f.path] {
+				files = append(files, f)
+			}
+		}
+		if len(files) < 2 {
+			continue
+		}
+		g.files = files
+		g.keep = 0
+		for i, f := range files {
+			if f.path == kept.path {
+				g.keep = i
+			}
+		}
+		groups = append(groups, g)
+	}
+	dups.groups = groups
+	dups.cursor = Max(0, Min(dups.cursor, m.dupFileCount()-1))
+}
+
+// Trashes the files that are not kept in the hovered group, or in every
+// group
+func (m *model) TrashDups(all bool) {
+	paths := []string{}
+	done := map[string]bool{}
+	for _, g := range m.dupTargets(all) {
+		for i, f := range g.files {
+			if i != g.keep {
+				paths = append(paths, f.path)
+				paths = append(paths, f.links...)
+				done[f.path] = true
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	info := RunBlock("trash", paths...)
+	if info.err != nil {
+		m.appendRunError("Error trashing duplicates", info)
+		return
+	}
+	m.emitHook(onOperation, paths, map[string]string{"operation": "trash"})
+
+	m.forgetDups(done)
+	m.dups.message = "Trashed " + plural(len(paths), "file")
+}
+
+// Returns an error if the file at path, which is a name of f, was changed
+// since it was scanned
+func checkUnchanged(path string, f dupFile) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Size() != f.size || !info.ModTime().Equal(f.modTime) {
+		return fmt.Errorf("%s changed since it was scanned", path)
+	}
+	return nil
+}
+
+// Replaces the file at path, which is a name of f, with a hard link to
+// target.  Neither may have changed since they were scanned.  The link is
+// made beside path and renamed over it, so path is never missing.
+func replaceWithLink(target dupFile, path string, f dupFile) error {
+	if err := checkUnchanged(target.path, target); err != nil {
+		return err
+	}
+	if err := checkUnchanged(path, f); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), ".bfm-link-"+filepath.Base(path))
+	if err := os.Link(target.path, tmp); err != nil {
+		return fmt.Errorf("%s: %w", path, err.(*os.LinkError).Err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Replaces the files that are not kept in the hovered group, or in every
+// group, with hard links to the kept file
+func (m *model) LinkDups(all bool) {
+	linked := []string{}
+	errors := []string{}
+	done := map[string]bool{}
+	for _, g := range m.dupTargets(all) {
+		target := g.files[g.keep]
+		for i, f := range g.files {
+			if i == g.keep {
+				continue
+			}
+			failed := false
+			for _, path := range append([]string{f.path}, f.links...) {
+				if err := replaceWithLink(target, path, f); err != nil {
+					errors = append(errors, err.Error())
+					failed = true
+					continue
+				}
+				log.Printf("Replaced %s with a hard link to %s", path, target.path)
+				linked = append(linked, path)
+			}
+			if !failed {
+				done[f.path] = true
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		m.appendError(formatProblems("Problems linking duplicates", errors))
+	}
+	if len(linked) == 0 {
+		return
+	}
+	m.emitHook(onOperation, linked, map[string]string{"operation": "link_hard"})
+
+	m.forgetDups(done)
+	m.dups.message = "Linked " + plural(len(linked), "file")
+}
+
+// Renders the groups of duplicates in dups mode
+func (m *model) generateDups() string {
+	dups := m.dups
+	doc := strings.Builder{}
+
+	var wasted int64
+	for _, g := range dups.groups {
+		wasted += g.wasted()
+	}
+	header := fmt.Sprintf("%s  %s, %s in copies", dups.root, plural(len(dups.groups), "group"), strings.TrimSpace(formatSize(wasted)))
+	if dups.message != "" {
+		header += "  " + dups.message
+	}
+	doc.WriteString(rSection(header) + "\n")
+
+	if len(dups.groups) == 0 {
+		doc.WriteString("  No duplicates found\n")
+		return doc.String()
+	}
+
+	i := 0
+	for _, g := range dups.groups {
+		doc.WriteString(rSubtle(fmt.Sprintf("  %d copies of %s", len(g.files), strings.TrimSpace(formatSize(g.size)))) + "\n")
+		for j, f := range g.files {
+			cursorText := "  "
+			style := fileDefault
+			if i == dups.cursor {
+				cursorText = "> "
+				style = style.Copy().Background(cursorBgColor)
+			}
+
+			keepText := "      "
+			if j == g.keep {
+				keepText = okStyle.Render("keep") + "  "
+			}
+
+			name := f.path
+			if rel, err := filepath.Rel(dups.root, f.path); err == nil {
+				name = rel
+			}
+			if len(f.links) > 0 {
+				name += fmt.Sprintf(" (+%s)", plural(len(f.links), "hard link"))
+			}
+
+			doc.WriteString(cursorStyle.Render(cursorText))
+			doc.WriteString(keepText)
+			doc.WriteString(style.Render(truncateFileName(name, Max(10, m.termWidth-10))))
+			doc.WriteString("\n")
+			i++
+		}
+	}
+
+	return doc.String()
+}
+
+// Handles keys in dups mode
+func (m *model) handleDupKey(key string) tea.Cmd {
+	dups := m.dups
+	dups.message = ""
+
+	switch key {
+	case "esc", "q":
+		m.mode = commandMode
+		return refresh()
+	case "j", "down":
+		m.MoveDupCursor(1)
+	case "k", "up":
+		m.MoveDupCursor(-1)
+	case "ctrl+d":
+		m.MoveDupCursor(m.viewportHeight / 2)
+	case "ctrl+u":
+		m.MoveDupCursor(-m.viewportHeight / 2)
+	case "g":
+		m.MoveDupCursor(-dups.cursor)
+	case "G":
+		m.MoveDupCursor(m.dupFileCount())
+	case " ", "enter":
+		if g, i := m.dupHovered(); g != nil {
+			g.keep = i
+		}
+	case "t", "T":
+		m.TrashDups(key == "T")
+		m.MoveDupCursor(0)
+	case "h", "H":
+		m.LinkDups(key == "H")
+		m.MoveDupCursor(0)
+	case "c":
+		// cd to the hovered file
+		if g, i := m.dupHovered(); g != nil {
+			m.mode = commandMode
+			path := g.files[i].path
+			return tea.Sequence(cd(filepath.Dir(path)), selectFile(filepath.Base(path)))
+		}
+	}
+
+	m.viewport.SetContent(m.generateContent())
+	return nil
+}
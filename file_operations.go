@@ -1,5 +1,5 @@
 // This file contains file operations such as refresh, cd, move, copy, trash,
-// open (os default app), remove, edit (EDITOR), rename, bulk rename, duplicate, mkdir,
+// open (see opener.go), remove, edit (EDITOR), rename, bulk rename, duplicate, mkdir,
 
 package main
 
@@ -63,7 +63,7 @@ func userError(msg string) tea.Cmd {
 
 
 func (m *model) handleRefresh() (model, tea.Cmd) {
-	if m.mode == selectedMode {
+	if m.mode == selectedMode || m.mode == panelMode || m.mode == duMode || m.mode == dupsMode || m.mode == compareMode {
 		m.viewport.SetContent(m.generateContent())
 		return *m, nil
 	}
@@ -71,8 +71,7 @@ func (m *model) handleRefresh() (model, tea.Cmd) {
 	// If files were moved or removed, the cursor needs to still be in range
 	ct := m.CurrentTab
 
-	var err error
-	ct.files, err = getDirEntries(ct.directory)
+	files, err := getDirEntries(ct.directory)
 	if (err != nil) {
 		if ct.directory == "/" {
 			log.Fatal("Cannot get contents of the root folder")
@@ -82,23 +81,19 @@ func (m *model) handleRefresh() (model, tea.Cmd) {
 			return *m, cd(parent)
 		}
 	}
+	if ct.flat {
+		files = ct.flattenFiles(files)
+	}
+	ct.files = files
+	ct.reloadExpanded()
 	log.Printf("Read dir %s for tab %d", ct.directory, m.CurrentTabIndex)
-	ct.ReRunFilter()
-	log.Printf("Re-ran filter for tab %d", m.CurrentTabIndex)
 
-	// Don't change the cursor unless it's no longer valid
-	if ct.cursor == -1 {
-		if len(ct.filteredFiles) > 0 {
-			ct.cursor = 0;
-		}
-	} else {
-		ct.cursor = Min(len(ct.filteredFiles)-1, ct.cursor)
-		log.Printf("cursor: %d", ct.cursor)
-	}
+	// Files may have been renamed or removed, so follow the hovered file
+	ct.ReRunFilter()
+	log.Printf("Re-ran filter for tab %d, cursor: %d", m.CurrentTabIndex, ct.cursor)
 
-	//m.viewport.GotoTop()
 	m.viewport.SetContent(m.generateContent())
-	//m.checkScrollDown()
+	m.scrollToCursor()
 
 	return *m, nil
 }
@@ -111,26 +106,50 @@ func (td *tabData) ChangeDirectory(path string) (error) {
 		return err
 	}
 
+	archive := ""
 	file_info, err := os.Stat(path)
+	if err != nil || !file_info.IsDir() {
+		// Archives and the directories in them are listed like directories
+		var inArchive bool
+		archive, _, inArchive = splitArchivePath(path)
+		if !inArchive && err != nil {
+			return err
+		}
+		if !inArchive {
+			return errors.New("Not a directory")
+		}
+	}
+
+	files, err := getDirEntries(path)
 	if err != nil {
+		if archive == "" {
+			log.Fatal("Cannot get contents of "+path)
+		}
 		return err
 	}
-	if ! file_info.IsDir() {
-		return errors.New("Not a directory")
-	}
 
+	td.rememberDir()
+	previous := td.absdir
 	td.directory = path
 	td.absdir, _ = filepath.Abs(path)
-
-	td.files, err = getDirEntries(td.directory)
-	if (err != nil) {
-		log.Fatal("Cannot get contents of "+td.directory)
-	}
+	td.archive = archive
+	td.files = files
+	td.expanded = nil
+	hovered := td.restoreDir(td.absdir)
+	if td.flat {
+		// Hidden files are skipped by the walk, so it needs the directory's settings
+		td.files = td.flattenFiles(files)
+	}
+	td.filter = ""
+	td.filterFiles()
 	td.cursor = 0
-
-	// Maybe this should be an option SORT=keep or SORT=reset
-	//td.sort = modifiedSort
-	td.SetFilter("")
+	if previous != td.absdir && filepath.Dir(previous) == td.absdir {
+		// Land on the directory we came up from
+		hovered = filepath.Base(previous)
+	}
+	if hovered != "" {
+		td.JumpToFile(hovered)
+	}
 
 	return nil
 }
@@ -166,6 +185,8 @@ func (m *model) MoveFiles() tea.Cmd {
 		info := RunBlock("mv", args...)
 		if info.err != nil {
 			m.appendRunError("Error moving file(s)", info)
+		} else {
+			m.emitHook(onOperation, paths, map[string]string{"operation": "move", "destination": dst})
 		}
 		m.ClearSelections()
 
@@ -184,9 +205,19 @@ func (m *model) CopyFiles() tea.Cmd {
 	var paths []string
 	var errors []string
 
+	// Files in archives are copied out of each archive in one pass
+	var archives []string
+	members := map[string][]string{}
+
 	for _, sf := range(m.selectedFiles) {
 		if (sf.directory == dst) {
 			errors = append(errors, fmt.Sprintf("%s is already in %s", sf.file.Name(), dst))
+		} else if e, ok := sf.file.(*archiveEntry); ok {
+			log.Printf("Copying %s from %s to %s", e.inner, e.archive, dst)
+			if _, found := members[e.archive]; !found {
+				archives = append(archives, e.archive)
+			}
+			members[e.archive] = append(members[e.archive], e.inner)
 		} else {
 			src := fmt.Sprintf("%s/%s", sf.directory, sf.file.Name())
 
@@ -199,13 +230,32 @@ func (m *model) CopyFiles() tea.Cmd {
 		m.appendError(strings.Join(errors, "\n"))
 		return nil
 	} else {
-		args := []string{"-r"}
-		args = append(args, paths...)
-		args = append(args, dst)
+		var copied []string
+		if len(paths) > 0 {
+			args := []string{"-r"}
+			args = append(args, paths...)
+			args = append(args, dst)
+
+			info := RunBlock("cp", args...)
+			if info.err != nil {
+				m.appendRunError("Error copying file(s)", info)
+			} else {
+				copied = paths
+			}
+		}
 
-		info := RunBlock("cp", args...)
-		if info.err != nil {
-			m.appendRunError("Error copying file(s)", info)
+		for _, archive := range archives {
+			problems := copyFromArchive(archive, members[archive], dst)
+			if len(problems) > 0 {
+				m.appendError("Problems copying from " + archive + ":\n\n" + strings.Join(problems, "\n"))
+			}
+			for _, inner := range members[archive] {
+				copied = append(copied, filepath.Join(archive, inner))
+			}
+		}
+
+		if len(copied) > 0 {
+			m.emitHook(onOperation, copied, map[string]string{"operation": "copy", "destination": dst})
 		}
 		m.ClearSelections()
 
@@ -213,6 +263,112 @@ func (m *model) CopyFiles() tea.Cmd {
 	}
 }
 
+// Kinds of links made by LinkFiles
+const (
+	symlinkAbsolute = iota
+	symlinkRelative = iota
+	hardLink        = iota
+)
+
+var linkOperations = map[int]string{
+	symlinkAbsolute: "symlink_absolute",
+	symlinkRelative: "symlink_relative",
+	hardLink:        "hard_link",
+}
+
+// Links the selected files into the current directory.  Like CopyFiles,
+// nothing is linked if any file is already in the current directory.
+func (m *model) LinkFiles(kind int) tea.Cmd {
+	if len(m.selectedFiles) == 0 {
+		m.appendError("No files selected to link")
+		return nil
+	}
+
+	dst := m.CurrentTab.absdir
+
+	var errors []string
+	for _, sf := range m.selectedFiles {
+		if sf.directory == dst {
+			errors = append(errors, fmt.Sprintf("%s is already in %s", sf.file.Name(), dst))
+		} else if _, err := os.Lstat(filepath.Join(dst, sf.file.Name())); err == nil {
+			errors = append(errors, fmt.Sprintf("%s already exists in %s", sf.file.Name(), dst))
+		}
+	}
+	if len(errors) > 0 {
+		m.appendError(strings.Join(errors, "\n"))
+		return nil
+	}
+
+	var linked []string
+	for _, sf := range m.selectedFiles {
+		src := filepath.Join(sf.directory, sf.file.Name())
+		link := filepath.Join(dst, sf.file.Name())
+
+		var err error
+		switch kind {
+		case symlinkAbsolute:
+			err = os.Symlink(src, link)
+		case symlinkRelative:
+			var target string
+			target, err = filepath.Rel(dst, src)
+			if err == nil {
+				err = os.Symlink(target, link)
+			}
+		case hardLink:
+			err = os.Link(src, link)
+		}
+
+		if linkErr, ok := err.(*os.LinkError); ok {
+			err = linkErr.Err
+		}
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Error linking %s: %s", src, err))
+			continue
+		}
+		log.Printf("Linked %s to %s", link, src)
+		linked = append(linked, src)
+	}
+
+	if len(errors) > 0 {
+		m.appendError(strings.Join(errors, "\n"))
+	}
+	if len(linked) > 0 {
+		m.emitHook(onOperation, linked, map[string]string{"operation": linkOperations[kind], "destination": dst})
+	}
+	m.ClearSelections()
+
+	return refresh()
+}
+
+// Changes to the directory of the file the hovered symlink finally points
+// to, with the cursor on that file
+func (m *model) FollowLink() tea.Cmd {
+	if !m.isHoveredValid() {
+		return nil
+	}
+
+	path := m.getHoveredPath()
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		m.appendError(filepath.Base(path) + " is not a symlink")
+		return nil
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		m.appendError("Error following " + path + ": " + err.Error())
+		return nil
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		m.appendError("Error following " + path + ": " + err.Error())
+		return nil
+	}
+
+	log.Printf("Following %s to %s", path, target)
+	return tea.Sequence(cd(filepath.Dir(target)), selectFile(filepath.Base(target)))
+}
+
 func (m *model) TrashFiles() tea.Cmd {
 	var paths []string
 
@@ -233,6 +389,8 @@ func (m *model) TrashFiles() tea.Cmd {
 	info := RunBlock("trash", paths...)
 	if info.err != nil {
 		m.appendRunError("Error trashing file", info)
+	} else {
+		m.emitHook(onOperation, paths, map[string]string{"operation": "trash"})
 	}
 
 	m.ClearSelections()
@@ -240,30 +398,23 @@ func (m *model) TrashFiles() tea.Cmd {
 	return refresh()
 }
 
+// Opens the selected or hovered files with the opener that matches each
 func (m *model) OpenFiles() tea.Cmd {
-	var paths []string
-
-	if len(m.selectedFiles) == 0 {
-		ct := m.CurrentTab
-		file := ct.filteredFiles[ct.cursor]
-		path := filepath.Join(ct.absdir, file.Name())
-		paths = append(paths, path)
-	} else {
-		for _, sf := range(m.selectedFiles) {
-			path := filepath.Join(sf.directory, sf.file.Name())
-			paths = append(paths, path)
-		}
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		m.appendError("No files to open")
+		return nil
 	}
 
-	args := append([]string{"--"}, paths...)
-	info := RunBlock("open", args...)
-	if info.err != nil {
-		m.appendRunError("Error opening file", info)
+	cmds := []tea.Cmd{}
+	for _, group := range groupByOpener(paths) {
+		cmds = append(cmds, m.runOpener(group.opener, m.CurrentTab.absdir, group.paths))
 	}
 
+	m.emitHook(onOperation, paths, map[string]string{"operation": "open"})
 	m.ClearSelections()
 
-	return refresh()
+	return tea.Sequence(append(cmds, refresh())...)
 }
 
 // Allows user to specify name of new directory in EDITOR
@@ -318,6 +469,8 @@ func (m *model) FinishMkDir(f string) tea.Cmd {
 	defer file.Close()
 	defer os.Remove(f)
 
+	var created []string
+
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		
@@ -335,6 +488,8 @@ func (m *model) FinishMkDir(f string) tea.Cmd {
 			if err != nil {
 				log.Printf("%s", err.Error())
 				m.appendError("Error creating directory "+dir_name+":"+err.Error())
+			} else {
+				created = append(created, dst)
 			}
 
 			log.Printf("Made directory %s", dst)
@@ -347,6 +502,10 @@ func (m *model) FinishMkDir(f string) tea.Cmd {
 		return nil
 	}
 
+	if len(created) > 0 {
+		m.emitHook(onOperation, created, map[string]string{"operation": "mkdir"})
+	}
+
 	return refresh()
 }
 
@@ -423,6 +582,7 @@ func (m *model) FinishRename(f string) tea.Cmd {
 	os.Rename(src, dst)
 
 	log.Printf("Renamed %s to %s", hoveredFile.Name(), dst_name)
+	m.emitHook(onOperation, []string{dst}, map[string]string{"operation": "rename", "source": src})
 	return refresh()
 }
 
@@ -506,6 +666,8 @@ func (m *model) FinishBulkRename(f string, src_names []string) tea.Cmd {
 	if len(issues) > 0 {
 		m.appendError(strings.Join(issues, "\n"))
 	} else {
+		var renamed []string
+
 		// Only perform the rename if there were no errors
 		for i, dst_name := range dst_names {
 			var errors []string
@@ -518,6 +680,7 @@ func (m *model) FinishBulkRename(f string, src_names []string) tea.Cmd {
 					src := filepath.Join(m.CurrentTab.absdir, src_name)
 					dst := filepath.Join(m.CurrentTab.absdir, dst_name)
 					os.Rename(src, dst)
+					renamed = append(renamed, dst)
 					log.Printf("Renamed %s to %s", src_name, dst_name)
 				} else {
 					log.Printf("DEBUG: %s not renamed", src_name)
@@ -527,6 +690,9 @@ func (m *model) FinishBulkRename(f string, src_names []string) tea.Cmd {
 				m.appendError(strings.Join(errors, "\n"))
 			}
 		}
+		if len(renamed) > 0 {
+			m.emitHook(onOperation, renamed, map[string]string{"operation": "bulk_rename"})
+		}
 		return refresh()
 	}
 
@@ -643,6 +809,7 @@ func (m *model) FinishDuplicate(f string) tea.Cmd {
 		}
 
 		log.Printf("Duplicated %s to %s", hoveredFile.Name(), dst_name)
+		m.emitHook(onOperation, []string{dst}, map[string]string{"operation": "duplicate", "source": src})
 		return refresh()
 	} else if isDir(src) {
 
@@ -652,6 +819,8 @@ func (m *model) FinishDuplicate(f string) tea.Cmd {
 		info := RunBlock("cp", args...)
 		if info.err != nil {
 			m.appendRunError("Error duplicating file", info)
+		} else {
+			m.emitHook(onOperation, []string{dst}, map[string]string{"operation": "duplicate", "source": src})
 		}
 
 		log.Printf("Duplicated %s to %s", src, dst)
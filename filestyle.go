@@ -0,0 +1,410 @@
+// This file contains code for styling file names in the listing.  Rules
+// from [[file_styles]] in bfmrc are tried first, then $LS_COLORS (when
+// ls_colors is set), then the styles of the theme.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Kinds of files as far as styling is concerned.  Rules in [[file_styles]]
+// may use these or any file category (see classify.go) as a type.
+const (
+	kindFile          = "file"
+	kindDirectory     = "directory"
+	kindSymlink       = "symlink"
+	kindBrokenSymlink = "broken_symlink"
+	kindExecutable    = "executable"
+	kindSocket        = "socket"
+	kindPipe          = "pipe"
+	kindDevice        = "device"
+	kindSetuid        = "setuid"
+	kindSetgid        = "setgid"
+)
+
+var fileKinds = []string{kindFile, kindDirectory, kindSymlink, kindBrokenSymlink, kindExecutable,
+	kindSocket, kindPipe, kindDevice, kindSetuid, kindSetgid}
+
+type fileStyleRule struct {
+	globs []string
+	types []string
+	style lipgloss.Style
+}
+
+type lsSuffix struct {
+	suffix string // lowercase
+	style  lipgloss.Style
+}
+
+type lsColorTable struct {
+	types      map[string]lipgloss.Style // Keyed by the two letter LS_COLORS code
+	suffixes   []lsSuffix
+	linkTarget bool // ln=target styles symlinks like the file they point to
+}
+
+// Set by LoadFileStyles
+var (
+	fileStyleRules []fileStyleRule
+	lsColors       *lsColorTable
+)
+
+// Describes the file f in dir for styling
+type styledFile struct {
+	dir    string
+	entry  fs.DirEntry
+	kind   string
+	lsCode string      // LS_COLORS code of the file
+	target fs.FileInfo // What a symlink points to
+	isDir  bool        // Directory or symlink to a directory
+}
+
+func describeFile(dir string, f fs.DirEntry) styledFile {
+	sf := styledFile{dir: dir, entry: f, kind: kindFile, lsCode: "fi"}
+
+	mode := f.Type()
+	if info, err := f.Info(); err == nil {
+		mode = info.Mode()
+	}
+
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Stat(filepath.Join(dir, f.Name()))
+		if err != nil {
+			sf.kind, sf.lsCode = kindBrokenSymlink, "or"
+		} else {
+			sf.kind, sf.lsCode = kindSymlink, "ln"
+			sf.target = target
+			sf.isDir = target.IsDir()
+		}
+	case mode.IsDir():
+		sf.kind, sf.lsCode, sf.isDir = kindDirectory, directoryCode(mode), true
+	case mode&os.ModeNamedPipe != 0:
+		sf.kind, sf.lsCode = kindPipe, "pi"
+	case mode&os.ModeSocket != 0:
+		sf.kind, sf.lsCode = kindSocket, "so"
+	case mode&os.ModeCharDevice != 0:
+		sf.kind, sf.lsCode = kindDevice, "cd"
+	case mode&os.ModeDevice != 0:
+		sf.kind, sf.lsCode = kindDevice, "bd"
+	case mode&os.ModeSetuid != 0:
+		sf.kind, sf.lsCode = kindSetuid, "su"
+	case mode&os.ModeSetgid != 0:
+		sf.kind, sf.lsCode = kindSetgid, "sg"
+	case mode.Perm()&0111 != 0:
+		sf.kind, sf.lsCode = kindExecutable, "ex"
+	}
+	return sf
+}
+
+// Returns the LS_COLORS code for a directory with mode
+func directoryCode(mode fs.FileMode) string {
+	otherWritable := mode.Perm()&0002 != 0
+	sticky := mode&os.ModeSticky != 0
+	switch {
+	case sticky && otherWritable:
+		return "tw"
+	case otherWritable:
+		return "ow"
+	case sticky:
+		return "st"
+	}
+	return "di"
+}
+
+// Returns true if the rule applies to the file
+func (r fileStyleRule) matches(sf styledFile) bool {
+	for _, glob := range r.globs {
+		if matched, _ := filepath.Match(glob, sf.entry.Name()); matched {
+			return true
+		}
+	}
+	for _, t := range r.types {
+		if t == sf.kind || (t == kindSymlink && sf.kind == kindBrokenSymlink) {
+			return true
+		}
+		if _, isCategory := parseCategory(t); isCategory && !Contains(fileKinds, t) {
+			if classify(sf.dir, sf.entry).category.String() == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the style LS_COLORS gives the file
+func (t *lsColorTable) styleFor(sf styledFile) (lipgloss.Style, bool) {
+	code := sf.lsCode
+	if sf.kind == kindSymlink && t.linkTarget {
+		code = "fi"
+		if sf.target.IsDir() {
+			code = directoryCode(sf.target.Mode())
+		} else if sf.target.Mode().Perm()&0111 != 0 {
+			code = "ex"
+		}
+	}
+
+	if style, found := t.types[code]; found {
+		return style, true
+	}
+
+	// Fall back like ls does
+	switch code {
+	case "or":
+		style, found := t.types["ln"]
+		return style, found
+	case "tw", "ow", "st":
+		style, found := t.types["di"]
+		return style, found
+	case "fi", "ex", "su", "sg":
+		// The longest matching suffix wins so *.tar.gz beats *.gz
+		name := strings.ToLower(sf.entry.Name())
+		best := -1
+		for i, s := range t.suffixes {
+			if strings.HasSuffix(name, s.suffix) && (best == -1 || len(s.suffix) > len(t.suffixes[best].suffix)) {
+				best = i
+			}
+		}
+		if best != -1 {
+			return t.suffixes[best].style, true
+		}
+		style, found := t.types["fi"]
+		return style, found
+	}
+	return lipgloss.Style{}, false
+}
+
+// Returns the style of the theme for the file
+func defaultFileStyle(sf styledFile) lipgloss.Style {
+	switch sf.kind {
+	case kindDirectory:
+		return directory
+	case kindSymlink:
+		if sf.isDir {
+			return symDirectory
+		}
+	case kindBrokenSymlink:
+		return brokenLink
+	case kindSocket, kindPipe, kindDevice:
+		return specialFile
+	case kindSetuid, kindSetgid:
+		return setuidFile
+	case kindExecutable:
+		return executable
+	}
+
+	switch classify(sf.dir, sf.entry).category {
+	case categorySpreadsheet:
+		return excel
+	case categoryDocument:
+		return wordDoc
+	case categoryPDF:
+		return pdf
+	}
+	return fileDefault
+}
+
+// Returns the style for the name of the file f in dir
+func fileStyleFor(dir string, f fs.DirEntry) lipgloss.Style {
+	sf := describeFile(dir, f)
+
+	for _, rule := range fileStyleRules {
+		if rule.matches(sf) {
+			return rule.style
+		}
+	}
+
+	if lsColors != nil {
+		if style, found := lsColors.styleFor(sf); found {
+			return style
+		}
+	}
+
+	return defaultFileStyle(sf)
+}
+
+// Converts an SGR sequence like "01;38;5;208" to a style.  Codes that
+// cannot be shown (like blink) are ignored.
+func parseSGR(sgr string) (lipgloss.Style, error) {
+	style := lipgloss.NewStyle()
+	if sgr == "" {
+		return style, nil
+	}
+
+	codes := strings.Split(sgr, ";")
+	for i := 0; i < len(codes); i++ {
+		n, err := strconv.Atoi(codes[i])
+		if err != nil {
+			return style, fmt.Errorf("invalid code %q in %q", codes[i], sgr)
+		}
+
+		switch {
+		case n == 0:
+			style = lipgloss.NewStyle()
+		case n == 1:
+			style = style.Bold(true)
+		case n == 2:
+			style = style.Faint(true)
+		case n == 3:
+			style = style.Italic(true)
+		case n == 4:
+			style = style.Underline(true)
+		case n == 7:
+			style = style.Reverse(true)
+		case n == 9:
+			style = style.Strikethrough(true)
+		case n >= 30 && n <= 37:
+			style = style.Foreground(lipgloss.Color(strconv.Itoa(n - 30)))
+		case n >= 40 && n <= 47:
+			style = style.Background(lipgloss.Color(strconv.Itoa(n - 40)))
+		case n >= 90 && n <= 97:
+			style = style.Foreground(lipgloss.Color(strconv.Itoa(n - 90 + 8)))
+		case n >= 100 && n <= 107:
+			style = style.Background(lipgloss.Color(strconv.Itoa(n - 100 + 8)))
+		case n == 38 || n == 48:
+			// Extended colors: 38;5;n or 38;2;r;g;b
+			var color lipgloss.Color
+			if i+2 < len(codes) && codes[i+1] == "5" {
+				color = lipgloss.Color(codes[i+2])
+				i += 2
+			} else if i+4 < len(codes) && codes[i+1] == "2" {
+				rgb := [3]int{}
+				for j := range rgb {
+					rgb[j], err = strconv.Atoi(codes[i+2+j])
+					if err != nil {
+						return style, fmt.Errorf("invalid color in %q", sgr)
+					}
+				}
+				color = lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]))
+				i += 4
+			} else {
+				return style, fmt.Errorf("invalid extended color in %q", sgr)
+			}
+			if n == 38 {
+				style = style.Foreground(color)
+			} else {
+				style = style.Background(color)
+			}
+		}
+	}
+	return style, nil
+}
+
+// Parses the value of $LS_COLORS
+func parseLsColors(value string) (*lsColorTable, []string) {
+	problems := []string{}
+	table := &lsColorTable{types: map[string]lipgloss.Style{}}
+
+	for _, entry := range strings.Split(value, ":") {
+		key, sgr, found := strings.Cut(entry, "=")
+		if !found {
+			continue
+		}
+
+		if key == "ln" && sgr == "target" {
+			table.linkTarget = true
+			continue
+		}
+
+		style, err := parseSGR(sgr)
+		if err != nil {
+			problems = append(problems, "LS_COLORS: "+key+": "+err.Error())
+			continue
+		}
+
+		if suffix, isPattern := strings.CutPrefix(key, "*"); isPattern {
+			table.suffixes = append(table.suffixes, lsSuffix{strings.ToLower(suffix), style})
+		} else {
+			table.types[key] = style
+		}
+	}
+	return table, problems
+}
+
+// Builds the style for a [[file_styles]] rule
+func (rule FileStyle) build() (lipgloss.Style, []string) {
+	problems := []string{}
+
+	style, err := parseSGR(rule.Style)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if rule.Fg != "" {
+		if validColor(rule.Fg) {
+			style = style.Foreground(lipgloss.Color(rule.Fg))
+		} else {
+			problems = append(problems, fmt.Sprintf("invalid color %q", rule.Fg))
+		}
+	}
+	if rule.Bg != "" {
+		if validColor(rule.Bg) {
+			style = style.Background(lipgloss.Color(rule.Bg))
+		} else {
+			problems = append(problems, fmt.Sprintf("invalid color %q", rule.Bg))
+		}
+	}
+	if rule.Bold {
+		style = style.Bold(true)
+	}
+	if rule.Italic {
+		style = style.Italic(true)
+	}
+	if rule.Underline {
+		style = style.Underline(true)
+	}
+	if rule.Faint {
+		style = style.Faint(true)
+	}
+	if rule.Strikethrough {
+		style = style.Strikethrough(true)
+	}
+	return style, problems
+}
+
+// Loads [[file_styles]] and $LS_COLORS.  Returns the problems found.
+func LoadFileStyles() []string {
+	problems := []string{}
+
+	fileStyleRules = nil
+	for i, rule := range config.FileStyles {
+		where := fmt.Sprintf("file_styles #%d", i+1)
+		if len(rule.Glob) == 0 && len(rule.Type) == 0 {
+			problems = append(problems, where+": needs glob or type")
+			continue
+		}
+		for _, t := range rule.Type {
+			if _, isCategory := parseCategory(t); !isCategory && !Contains(fileKinds, t) {
+				problems = append(problems, where+": unknown type "+t)
+			}
+		}
+
+		style, styleProblems := rule.build()
+		for _, p := range styleProblems {
+			problems = append(problems, where+": "+p)
+		}
+		fileStyleRules = append(fileStyleRules, fileStyleRule{rule.Glob, rule.Type, style})
+	}
+
+	lsColors = nil
+	if config.LsColors {
+		value := os.Getenv("LS_COLORS")
+		if value == "" {
+			log.Print("ls_colors is set but LS_COLORS is empty")
+		} else {
+			var lsProblems []string
+			lsColors, lsProblems = parseLsColors(value)
+			problems = append(problems, lsProblems...)
+		}
+	}
+
+	return problems
+}
@@ -22,9 +22,13 @@ func fwriteln(f *os.File, line string) {
 	}
 }
 
+// Returns the files in directory, which may be a directory in an archive
 func getDirEntries(directory string) ([]fs.DirEntry, error) {
 	files, err := os.ReadDir(directory)
 	if err != nil {
+		if archive, inner, ok := splitArchivePath(directory); ok {
+			return archiveDirEntries(archive, inner)
+		}
 		return files, err
 	}
 	return files, nil
@@ -0,0 +1,108 @@
+// This file contains the flat listing of a tab (flatten), which lists the
+// files under the tab's directory by their path relative to it.  Like the
+// nested files of tree mode, sorting, filtering, selection and operations
+// work on them as on any other file.
+
+package main
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Levels of directories below the tab's directory that are listed when
+// [flatten] depth is not set
+const flattenDefaultDepth = 4
+
+// Files listed at most, so a huge tree does not hang the listing
+const flattenMaxFiles = 50000
+
+// Returns the files under the tab's directory, given the files in it, named
+// by their path relative to it.  Directories are walked but not listed.
+func (td *tabData) flattenFiles(files []fs.DirEntry) []fs.DirEntry {
+	depth := config.Flatten.Depth
+	if depth == 0 {
+		depth = flattenDefaultDepth
+	}
+
+	flat := []fs.DirEntry{}
+	td.flatTruncated = false
+
+	var walk func(rel string, level int, files []fs.DirEntry)
+	walk = func(rel string, level int, files []fs.DirEntry) {
+		for _, f := range files {
+			if len(flat) >= flattenMaxFiles {
+				td.flatTruncated = true
+				return
+			}
+			if (!td.showHidden && strings.HasPrefix(f.Name(), ".")) || flattenIgnored(f.Name()) {
+				continue
+			}
+
+			path := filepath.Join(rel, f.Name())
+			if !f.IsDir() {
+				if level == 0 {
+					flat = append(flat, f)
+				} else {
+					flat = append(flat, &treeEntry{DirEntry: f, path: path, depth: level})
+				}
+				continue
+			}
+
+			if depth > 0 && level >= depth {
+				continue
+			}
+			below, err := getDirEntries(filepath.Join(td.directory, path))
+			if err != nil {
+				// Skip what cannot be read, like find does
+				log.Printf("Error flattening %s: %s", path, err)
+				continue
+			}
+			walk(path, level+1, below)
+		}
+	}
+	walk("", 0, files)
+
+	return flat
+}
+
+// Returns true if name matches one of [flatten] ignore
+func flattenIgnored(name string) bool {
+	for _, glob := range config.Flatten.Ignore {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Turns the flat listing of the tab on or off
+func (m *model) ToggleFlatten() {
+	ct := m.CurrentTab
+	hovered := ""
+	if m.isHoveredValid() {
+		hovered = m.getHoveredDirEntry().Name()
+	}
+
+	files, err := getDirEntries(ct.directory)
+	if err != nil {
+		m.appendError("Error reading " + ct.directory + ": " + err.Error())
+		return
+	}
+
+	ct.flat = !ct.flat
+	ct.tree = false
+	ct.expanded = nil
+	if ct.flat {
+		files = ct.flattenFiles(files)
+	}
+	ct.files = files
+	ct.filterFiles()
+
+	// A nested file is no longer listed, so land on the directory it is in
+	ct.cursor = 0
+	ct.JumpToFile(strings.Split(hovered, string(filepath.Separator))[0])
+	m.scrollToCursor()
+}
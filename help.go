@@ -27,6 +27,9 @@ func help_keys(command string) string {
 	keys := ""
 
 	for _, key := range keys_for(command) {
+		if key == " " {
+			key = "space"
+		}
 		if keys == "" {
 			keys = k(key)
 		} else {
@@ -73,6 +76,12 @@ func generateHelp() string {
 	doc.WriteString(f("    %s - %s\n", p(help_keys("tab 5")),          d("Activate tab 5")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("tab 6")),          d("Activate tab 6")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("selected_files")), d("View selected files")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("jobs")),           d("View output of background jobs")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("cancel_job")),     d("Cancel the last background job")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("du")),             d("Disk usage of current directory (or load hovered scan)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("find_duplicates")), d("Find duplicate files under current directory")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("compare")),        d("Compare with the previous tab's directory (or two selected directories)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("info")),           d("Info on hovered file (or totals for selection)")))
 
 	writePlugins(&doc, "Application")
 
@@ -100,6 +109,9 @@ func generateHelp() string {
 	doc.WriteString(s("Navigation")+"\n")
 	doc.WriteString(f("    %s - %s\n", p(help_keys("up_directory")),                                  d("Parent directory")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("enter_directory")),                               d("Enter hovered directory")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("tree")),                                          d("Toggle tree view")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("expand")),                                        d("Expand/collapse hovered directory in tree view")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("flatten")),                                       d("Toggle flat listing of files under current directory")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("home")),                                          d("Home directory")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("history_back")+"/"+help_keys("history_forward")), d("Back/Next in jumplist")))
 
@@ -110,6 +122,14 @@ func generateHelp() string {
 	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_name")),     d("Sort by name")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_modified")), d("Sort by last modified")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_size")),     d("Sort by size (reverse)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_natural")),   d("Sort by name with numbers in order")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_extension")), d("Sort by extension")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_created")),   d("Sort by creation time")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_type")),      d("Sort by file type")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_reverse")),    d("Reverse the sort")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_dirs_first")), d("Toggle directories first")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("sort_case")),       d("Cycle case sensitive/insensitive/locale names")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("toggle_dir_sizes")), d("Toggle recursive directory sizes")))
 
 	doc.WriteString("\n\n")
 	doc.WriteString(s("Selection")+"\n")
@@ -123,19 +143,28 @@ func generateHelp() string {
 	doc.WriteString(s("Operations")+"\n")
 	doc.WriteString(f("    %s - %s\n", p(help_keys("move")),           d("Move selected files to current directory")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("copy")),           d("Copy selected files to current directory")))
-	doc.WriteString(f("    %s - %s\n", p(help_keys("open")),           d("Open file(s) (with open command/alias)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("link_symlink_absolute")), d("Symlink selected files into current directory (absolute)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("link_symlink_relative")), d("Symlink selected files into current directory (relative)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("link_hard")),             d("Hard link selected files into current directory")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("follow_link")),           d("Go to the target of hovered symlink")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("open")),           d("Open file(s) (with openers from bfmrc)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("open_with")),      d("Open file(s) with opener picked in FZF")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("edit")),           d("Edit file (with EDITOR environment variable)")))
 
 	doc.WriteString(f("    %s - %s\n", p(help_keys("mkdirs")),      d("Create New directory(ies)")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("duplicate")),   d("Duplicate file")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("rename")),      d("Rename hovered file")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("bulk_rename")), d("Bulk Rename with EDITOR")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("chmod")),       d("Change permissions and owners with EDITOR")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("trash")),       d("Trash file (with open command/alias)")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("remove")),      d("Remove selected or hovered file(s)/directory(s) (with rm -rf command)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("archive")),     d("Archive selected files (format picked in FZF)")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("extract")),     d("Extract selected archives here or to a folder")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("checksum")),    d("Checksum selected files (algorithm picked in FZF), or verify hovered SHA256SUMS")))
 
 	doc.WriteString(f("    %s - %s\n", p(help_keys("shell")),       d("Open Shell in current directory (exit to return)")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("editor")),      d("Open nvim in current directory (close to return)")))
-	doc.WriteString(f("    %s - %s\n", p(help_keys("files")),       d("Open Finder to current directory")))
+	doc.WriteString(f("    %s - %s\n", p(help_keys("files")),       d("Open current directory with the default opener")))
 	doc.WriteString(f("    %s - %s\n", p(help_keys("cat_to_null")), d("Cat the file to /dev/null to trigger OneDrive sync")))
 
 	writePlugins(&doc, "Operations")
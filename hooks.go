@@ -0,0 +1,179 @@
+// This file contains event hooks.  Hooks are plugins configured in bfmrc
+// with [[hooks]] that run in the background when an event occurs.  Details
+// about the event are appended to the state file as BFM_NAME=value lines.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	onStart     = "on_start"
+	onQuit      = "on_quit"
+	onCd        = "on_cd"
+	onSelect    = "on_select"
+	onOperation = "on_operation"
+)
+
+// How long bfm waits for hooks to finish when quitting
+const hookQuitTimeout = 5 * time.Second
+
+// Tracks hooks that are running so they can finish before bfm exits
+var runningHooks sync.WaitGroup
+
+type hookFinishedMsg struct {
+	command string
+	lines   []string
+}
+
+// Returns the hooks configured for event
+func hooksFor(event string) []Hook {
+	var hooks []Hook
+	for _, hook := range config.Hooks {
+		if hook.Event == event {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// Writes the state file for a hook.  The layout is the same as for plugins,
+// so helper.sh can read it, followed by the details of the event.
+func (m *model) writeHookState(event string, paths []string, details map[string]string) string {
+	ct := m.CurrentTab
+
+	tmpdir := os.Getenv("TMPDIR")
+
+	t, err := os.CreateTemp(tmpdir, "BFM-STATE-")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fwriteln(t, ct.absdir)
+	for _, path := range paths {
+		fwriteln(t, path)
+	}
+
+	fwriteln(t, "BFM_EVENT="+event)
+
+	keys := []string{}
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fwriteln(t, fmt.Sprintf("BFM_%s=%s", strings.ToUpper(key), details[key]))
+	}
+
+	err = t.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return t.Name()
+}
+
+// Runs the hooks configured for event in the background.  If paths is nil,
+// the selected or hovered files are written to the state file.
+func (m *model) emitHook(event string, paths []string, details map[string]string) {
+	hooks := hooksFor(event)
+	if len(hooks) == 0 {
+		return
+	}
+
+	if paths == nil {
+		paths = m.targetPaths()
+	}
+
+	for _, hook := range hooks {
+		fields := strings.Fields(hook.Command)
+		if len(fields) == 0 {
+			log.Printf("Hook for %s has no command", event)
+			continue
+		}
+
+		statepath := m.writeHookState(event, paths, details)
+		cmdpath := m.createCmd()
+
+		args := append([]string{statepath, cmdpath}, fields[1:]...)
+		c := exec.Command(pluginPath(fields[0]), args...) //nolint:gosec
+
+		var output bytes.Buffer
+		c.Stdout = &output
+		c.Stderr = &output
+
+		log.Printf("Running hook %s for %s", hook.Command, event)
+		runningHooks.Add(1)
+		go func() {
+			defer runningHooks.Done()
+			defer os.Remove(statepath)
+			defer os.Remove(cmdpath)
+
+			if err := c.Run(); err != nil {
+				log.Printf("Error running hook %s for %s: %s\n%s", hook.Command, event, err, output.String())
+			}
+
+			lines, err := readCmdFile(cmdpath)
+			if err != nil {
+				log.Printf("Error reading cmd file of hook %s: %s", hook.Command, err)
+				return
+			}
+			if len(lines) > 0 {
+				send(hookFinishedMsg{hook.Command, lines})
+			}
+		}()
+	}
+}
+
+// Reads the commands written by a plugin
+func readCmdFile(f string) ([]string, error) {
+	file, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// Called by Update to run the commands a hook wrote to its cmd file
+func (m *model) handleHookFinished(msg hookFinishedMsg) tea.Cmd {
+	teaCmds := []tea.Cmd{}
+	for _, line := range msg.lines {
+		log.Printf("Running command from hook %s: %s", msg.command, line)
+		teaCmds = append(teaCmds, m.toTeaCmd(line))
+	}
+	return tea.Sequence(teaCmds...)
+}
+
+// Waits for running hooks so that hooks run on quit are not interrupted
+func WaitForHooks() {
+	done := make(chan struct{})
+	go func() {
+		runningHooks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(hookQuitTimeout):
+		log.Printf("Timed out waiting for hooks to finish")
+	}
+}
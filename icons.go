@@ -0,0 +1,173 @@
+// This file contains the icons shown next to file names.  Icons come from
+// one of the sets below, chosen with icons in bfmrc, and may be overridden
+// per file name or extension with [icon_names] and [icon_extensions].
+
+package main
+
+import (
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+const (
+	iconsNerd    = "nerd"
+	iconsUnicode = "unicode"
+	iconsASCII   = "ascii"
+	iconsNone    = "none"
+)
+
+// Every icon must be one column wide
+type iconSet struct {
+	directory  string
+	file       string
+	categories map[fileCategory]string
+	extensions map[string]string // Lowercase without the dot
+}
+
+var iconSets = map[string]iconSet{
+	iconsNerd: {
+		directory: "",
+		file:      "󰈔",
+		categories: map[fileCategory]string{
+			categorySymlink:     "",
+			categoryDevice:      "",
+			categoryPipe:        "󰟥",
+			categoryPDF:         "",
+			categoryArchive:     "",
+			categoryText:        "",
+			categorySpreadsheet: "󰈛",
+			categoryImage:       "󰈟",
+		},
+		extensions: map[string]string{
+			"html": "",
+			"htm":  "",
+			"xml":  "",
+			"gz":   "",
+			"bz2":  "",
+		},
+	},
+	iconsUnicode: {
+		directory: "▸",
+		file:      "·",
+		categories: map[fileCategory]string{
+			categorySymlink:      "→",
+			categoryDevice:       "◆",
+			categoryPipe:         "¦",
+			categorySocket:       "≈",
+			categoryText:         "≡",
+			categoryCode:         "λ",
+			categoryImage:        "◩",
+			categoryAudio:        "♪",
+			categoryVideo:        "►",
+			categoryArchive:      "▤",
+			categoryDocument:     "¶",
+			categorySpreadsheet:  "▦",
+			categoryPresentation: "▭",
+			categoryPDF:          "¶",
+			categoryFont:         "ƒ",
+			categoryExecutable:   "»",
+		},
+		extensions: map[string]string{},
+	},
+	// Like ls -F
+	iconsASCII: {
+		directory: "/",
+		file:      "-",
+		categories: map[fileCategory]string{
+			categorySymlink:    "@",
+			categoryDevice:     "#",
+			categoryPipe:       "|",
+			categorySocket:     "=",
+			categoryExecutable: "*",
+		},
+		extensions: map[string]string{},
+	},
+}
+
+// Set by LoadIcons
+var (
+	icons          = iconSets[iconsNerd]
+	showIcons      = true
+	iconNames      = map[string]string{}
+	iconExtensions = map[string]string{}
+)
+
+// Chooses the icon set and overrides from bfmrc.  Returns the problems found.
+func LoadIcons() []string {
+	problems := []string{}
+
+	name := config.Icons
+	if name == "" {
+		name = iconsNerd
+	}
+
+	showIcons = name != iconsNone
+	if set, found := iconSets[name]; found {
+		icons = set
+	} else if showIcons {
+		names := []string{iconsNone}
+		for n := range iconSets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		problems = append(problems, "Unknown icon set "+name+" (choose from "+strings.Join(names, ", ")+")")
+		icons = iconSets[iconsNerd]
+	}
+
+	iconNames = config.IconNames
+	iconExtensions = map[string]string{}
+	for ext, icon := range config.IconExtensions {
+		iconExtensions[strings.TrimPrefix(strings.ToLower(ext), ".")] = icon
+	}
+
+	return problems
+}
+
+// Returns the number of columns used by the icon and the space after it
+func iconWidth() int {
+	if !showIcons {
+		return 0
+	}
+	return 2
+}
+
+// Returns the icon for the file f in dir
+func getIcon(dir string, f fs.DirEntry) string {
+	if icon, found := iconNames[f.Name()]; found {
+		return icon
+	}
+	if icon, found := iconExtensions[fileExtension(f.Name())]; found {
+		return icon
+	}
+
+	if f.IsDir() || isSymDir(dir, f) {
+		return icons.directory
+	}
+
+	class := classify(dir, f)
+
+	// The type of special files is more important than their name
+	switch class.category {
+	case categorySymlink, categoryDevice, categoryPipe, categorySocket:
+		if icon, found := icons.categories[class.category]; found {
+			return icon
+		}
+		return icons.file
+	}
+
+	// Scripts are executables too, like with ls -F
+	if info, err := f.Info(); err == nil && info.Mode().Perm()&0111 != 0 {
+		if icon, found := icons.categories[categoryExecutable]; found {
+			return icon
+		}
+	}
+
+	if icon, found := icons.extensions[fileExtension(f.Name())]; found {
+		return icon
+	}
+	if icon, found := icons.categories[class.category]; found {
+		return icon
+	}
+	return icons.file
+}
@@ -0,0 +1,280 @@
+// This file contains the info panel, which shows everything stat knows about
+// the hovered file, or totals for the selected files.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Symlink chains longer than this are reported as loops, like ELOOP
+const maxSymlinkHops = 40
+
+// Extended attribute values are cut to this many bytes
+const maxXattrValue = 64
+
+const infoTimeFormat = "2006-01-02 15:04:05.000000000 -0700"
+
+type xattr struct {
+	name  string
+	value []byte
+}
+
+// Opens the info panel for the selected files or the hovered file
+func (m *model) ShowInfo() {
+	var text string
+	if len(m.selectedFiles) > 0 {
+		text = m.generateSelectionInfo()
+	} else if m.isHoveredValid() {
+		text = generateFileInfo(m.getHoveredPath())
+	} else {
+		m.appendError("No file to show info for")
+		return
+	}
+
+	m.mode = panelMode
+	m.panel = panel{title: "INFO", render: func(*model) string { return text }}
+	m.viewport.SetContent(m.generateContent())
+	m.viewport.GotoTop()
+}
+
+func writeInfoLine(doc *strings.Builder, label string, value string) {
+	doc.WriteString(fmt.Sprintf("  %-12s %s\n", label, value))
+}
+
+// Returns what kind of file mode is, in words
+func describeMode(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symbolic link"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	}
+	return "regular file"
+}
+
+// Returns the mode bits as chmod takes them, like 4755
+func octalMode(mode fs.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+func formatInfoTime(t time.Time, known bool) string {
+	if !known {
+		return "unknown"
+	}
+	return t.Format(infoTimeFormat)
+}
+
+// Returns a line for each hop from the symlink at path to the file it
+// finally points to
+func symlinkChain(path string) []string {
+	lines := []string{}
+	visited := map[string]bool{}
+
+	for hop := 0; ; hop++ {
+		if hop == maxSymlinkHops || visited[path] {
+			return append(lines, brokenLink.Render("loop")+" at "+path)
+		}
+		visited[path] = true
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return append(lines, path+": "+err.Error())
+		}
+		next := target
+		if !filepath.IsAbs(next) {
+			next = filepath.Join(filepath.Dir(path), next)
+		}
+
+		info, err := os.Lstat(next)
+		if err != nil {
+			return append(lines, fmt.Sprintf("%s -> %s %s", path, target, brokenLink.Render("(broken)")))
+		}
+		lines = append(lines, fmt.Sprintf("%s -> %s", path, target))
+		if info.Mode()&os.ModeSymlink == 0 {
+			return lines
+		}
+		path = next
+	}
+}
+
+// Returns the value of an extended attribute as text if it is printable,
+// or as hex
+func formatXattrValue(value []byte) string {
+	cut := ""
+	if len(value) > maxXattrValue {
+		value = value[:maxXattrValue]
+		cut = "..."
+	}
+
+	s := strings.TrimRight(string(value), "\x00")
+	printable := utf8.ValidString(s)
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return fmt.Sprintf("%q%s", s, cut)
+	}
+	return fmt.Sprintf("0x%x%s", value, cut)
+}
+
+func generateFileInfo(path string) string {
+	doc := strings.Builder{}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "  Error reading " + path + ": " + err.Error() + "\n"
+	}
+	mode := info.Mode()
+
+	doc.WriteString(rSection("File") + "\n")
+	writeInfoLine(&doc, "Name", info.Name())
+	writeInfoLine(&doc, "Directory", filepath.Dir(path))
+	writeInfoLine(&doc, "Type", describeMode(mode))
+	writeInfoLine(&doc, "Size", fmt.Sprintf("%d bytes (%s)", info.Size(), strings.TrimSpace(formatSize(info.Size()))))
+	writeInfoLine(&doc, "Mode", fmt.Sprintf("%s (%s)", lsMode(mode), octalMode(mode)))
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		writeInfoLine(&doc, "Owner", fmt.Sprintf("%s (%d)", userName(stat.Uid), stat.Uid))
+		writeInfoLine(&doc, "Group", fmt.Sprintf("%s (%d)", groupName(stat.Gid), stat.Gid))
+		writeInfoLine(&doc, "Inode", fmt.Sprintf("%d", stat.Ino))
+		writeInfoLine(&doc, "Links", fmt.Sprintf("%d", stat.Nlink))
+		writeInfoLine(&doc, "Device", formatDevice(uint64(stat.Dev)))
+		if mode&os.ModeDevice != 0 {
+			writeInfoLine(&doc, "Device type", formatDevice(uint64(stat.Rdev)))
+		}
+		writeInfoLine(&doc, "Blocks", fmt.Sprintf("%d of 512 bytes (%s used, IO block %d)",
+			stat.Blocks, strings.TrimSpace(formatSize(int64(stat.Blocks)*512)), stat.Blksize))
+	}
+
+	doc.WriteString("\n" + rSection("Times") + "\n")
+	atime, ctime, known := statTimes(info)
+	btime, born := birthTime(path)
+	writeInfoLine(&doc, "Accessed", formatInfoTime(atime, known))
+	writeInfoLine(&doc, "Modified", formatInfoTime(info.ModTime(), true))
+	writeInfoLine(&doc, "Changed", formatInfoTime(ctime, known))
+	writeInfoLine(&doc, "Born", formatInfoTime(btime, born))
+
+	if mode&os.ModeSymlink != 0 {
+		doc.WriteString("\n" + rSection("Symlink") + "\n")
+		for _, line := range symlinkChain(path) {
+			doc.WriteString("  " + line + "\n")
+		}
+	}
+
+	doc.WriteString("\n" + rSection("Contents") + "\n")
+	class := classifyPath(path)
+	writeInfoLine(&doc, "Category", class.category.String())
+	mime := class.mime
+	if mime == "" {
+		mime = "unknown"
+	}
+	writeInfoLine(&doc, "MIME", mime)
+
+	doc.WriteString("\n" + rSection("Extended Attributes") + "\n")
+	xattrs, err := listXattrs(path)
+	switch {
+	case err != nil:
+		doc.WriteString("  " + err.Error() + "\n")
+	case len(xattrs) == 0:
+		doc.WriteString("  None\n")
+	}
+	for _, x := range xattrs {
+		writeInfoLine(&doc, x.name, formatXattrValue(x.value))
+	}
+
+	return doc.String()
+}
+
+// Returns totals for the selected files
+func (m *model) generateSelectionInfo() string {
+	doc := strings.Builder{}
+
+	kinds := map[string]int{}
+	directories := map[string]bool{}
+	missing := 0
+	var total int64
+	var oldest, newest time.Time
+
+	for _, sf := range m.selectedFiles {
+		directories[sf.directory] = true
+
+		info, err := os.Lstat(filepath.Join(sf.directory, sf.file.Name()))
+		if err != nil {
+			missing++
+			continue
+		}
+		kinds[describeMode(info.Mode())]++
+
+		size := info.Size()
+		if dirSize, known := fileSize(sf.directory, sf.file); known {
+			size = dirSize
+		}
+		total += size
+
+		mod := info.ModTime()
+		if oldest.IsZero() || mod.Before(oldest) {
+			oldest = mod
+		}
+		if newest.IsZero() || mod.After(newest) {
+			newest = mod
+		}
+	}
+
+	doc.WriteString(rSection("Selection") + "\n")
+	writeInfoLine(&doc, "Selected", fmt.Sprintf("%d", len(m.selectedFiles)))
+	writeInfoLine(&doc, "Directories", fmt.Sprintf("%d containing the selection", len(directories)))
+	label := "Types"
+	for _, kind := range []string{"regular file", "directory", "symbolic link", "named pipe", "socket", "character device", "block device"} {
+		if kinds[kind] > 0 {
+			writeInfoLine(&doc, label, fmt.Sprintf("%s: %d", kind, kinds[kind]))
+			label = ""
+		}
+	}
+	if missing > 0 {
+		writeInfoLine(&doc, label, fmt.Sprintf("no longer exist: %d", missing))
+	}
+	writeInfoLine(&doc, "Total size", fmt.Sprintf("%d bytes (%s)", total, strings.TrimSpace(formatSize(total))))
+	if showDirSizes {
+		writeInfoLine(&doc, "", "Directories count their contents once sized")
+	} else {
+		writeInfoLine(&doc, "", "Directories count only themselves")
+	}
+
+	if !oldest.IsZero() {
+		doc.WriteString("\n" + rSection("Modified") + "\n")
+		writeInfoLine(&doc, "Oldest", oldest.Format(infoTimeFormat))
+		writeInfoLine(&doc, "Newest", newest.Format(infoTimeFormat))
+	}
+
+	return doc.String()
+}
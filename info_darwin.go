@@ -0,0 +1,18 @@
+//go:build darwin
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// Returns the access and status change times of the file
+func statTimes(info fs.FileInfo) (time.Time, time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return time.Unix(stat.Atimespec.Unix()), time.Unix(stat.Ctimespec.Unix()), true
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// Returns the access and status change times of the file
+func statTimes(info fs.FileInfo) (time.Time, time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return time.Unix(stat.Atim.Unix()), time.Unix(stat.Ctim.Unix()), true
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// Access and status change times are not read on this platform
+func statTimes(info fs.FileInfo) (time.Time, time.Time, bool) {
+	return time.Time{}, time.Time{}, false
+}
+
+func formatDevice(dev uint64) string {
+	return fmt.Sprintf("%#x", dev)
+}
+
+func listXattrs(path string) ([]xattr, error) {
+	return nil, errors.New("Not supported on this platform")
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func formatDevice(dev uint64) string {
+	return fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev))
+}
+
+// Returns the extended attributes of the file at path, without following
+// symlinks
+func listXattrs(path string) ([]xattr, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil, errors.New("Not supported by the filesystem")
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := []xattr{}
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		x := xattr{name: name}
+		if n, err := unix.Lgetxattr(path, name, nil); err == nil && n > 0 {
+			x.value = make([]byte, n)
+			if n, err = unix.Lgetxattr(path, name, x.value); err == nil {
+				x.value = x.value[:n]
+			}
+		}
+		xattrs = append(xattrs, x)
+	}
+	return xattrs, nil
+}
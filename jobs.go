@@ -0,0 +1,297 @@
+// This file contains background jobs.  A job runs in its own goroutine so
+// the TUI stays responsive.  Jobs report output and status to the bubbletea
+// loop with program.Send, and the model is only modified in Update.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Limits memory used by jobs with a lot of output
+const maxJobOutput = 1000
+
+// Number of finished jobs kept for the log panel
+const maxFinishedJobs = 20
+
+type job struct {
+	id      int
+	name    string
+	cancel  context.CancelFunc
+	running bool
+	status  string   // Shown in the footer while running
+	output  []string // Shown in the log panel
+	err     error
+}
+
+// Passed to the function run by a job to report back to the user
+type jobHandle struct {
+	id  int
+	ctx context.Context
+}
+
+// Work run by a job in the background.  The function returned is run by
+// Update after the job finishes so that it may safely modify the model.
+type jobFunc func(h *jobHandle) (func(m *model) tea.Cmd, error)
+
+type jobOutputMsg struct {
+	id   int
+	line string
+}
+
+type jobStatusMsg struct {
+	id     int
+	status string
+}
+
+type jobFinishedMsg struct {
+	id     int
+	finish func(m *model) tea.Cmd
+	err    error
+}
+
+// The result of a job that finished while the user was busy elsewhere, like
+// editing the filter.  It is shown when command is run again on the same
+// files.
+type readyView struct {
+	key  string // What the result is of, like the directory scanned
+	show func(m *model)
+}
+
+func send(msg tea.Msg) {
+	if program != nil {
+		program.Send(msg)
+	}
+}
+
+// Appends line to the output shown in the log panel
+func (h *jobHandle) Log(line string) {
+	send(jobOutputMsg{h.id, line})
+}
+
+// Sets the status shown in the footer
+func (h *jobHandle) Status(status string) {
+	send(jobStatusMsg{h.id, status})
+}
+
+// Returns true if the user cancelled the job
+func (h *jobHandle) Cancelled() bool {
+	return h.ctx.Err() != nil
+}
+
+// Starts fn in the background
+func (m *model) StartJob(name string, fn jobFunc) tea.Cmd {
+	wasRunning := m.runningJobs() > 0
+
+	m.nextJobID++
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		id:      m.nextJobID,
+		name:    name,
+		cancel:  cancel,
+		running: true,
+	}
+	m.jobs = append(m.jobs, j)
+	log.Printf("Starting job %d: %s", j.id, name)
+
+	h := &jobHandle{j.id, ctx}
+	go func() {
+		finish, err := fn(h)
+		if err == nil && h.Cancelled() {
+			err = context.Canceled
+		}
+		send(jobFinishedMsg{h.id, finish, err})
+	}()
+
+	if wasRunning {
+		return nil
+	}
+	// Only one tick loop should run at a time
+	return m.spinner.Tick
+}
+
+func (m *model) findJob(id int) *job {
+	for _, j := range m.jobs {
+		if j.id == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (m *model) runningJobs() int {
+	count := 0
+	for _, j := range m.jobs {
+		if j.running {
+			count++
+		}
+	}
+	return count
+}
+
+// Cancels the most recently started job that is still running
+func (m *model) CancelJob() {
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		if m.jobs[i].running {
+			log.Printf("Cancelling job %d: %s", m.jobs[i].id, m.jobs[i].name)
+			m.jobs[i].cancel()
+			return
+		}
+	}
+	m.appendError("No background jobs are running")
+}
+
+// Called by Update when a job logs output
+func (m *model) handleJobOutput(msg jobOutputMsg) {
+	j := m.findJob(msg.id)
+	if j == nil {
+		return
+	}
+
+	j.output = append(j.output, msg.line)
+	if len(j.output) > maxJobOutput {
+		j.output = j.output[len(j.output)-maxJobOutput:]
+	}
+}
+
+// Called by Update when a job finishes
+func (m *model) handleJobFinished(msg jobFinishedMsg) tea.Cmd {
+	j := m.findJob(msg.id)
+	if j == nil {
+		return nil
+	}
+
+	j.running = false
+	j.err = msg.err
+	j.cancel()
+
+	if errors.Is(msg.err, context.Canceled) {
+		log.Printf("Job %d cancelled: %s", j.id, j.name)
+		j.output = append(j.output, "Cancelled")
+	} else if msg.err != nil {
+		log.Printf("Job %d failed: %s: %s", j.id, j.name, msg.err)
+		j.output = append(j.output, "Error: "+msg.err.Error())
+		m.appendError(fmt.Sprintf("%s failed: %s\n\nOutput is available in the log panel (%s)", j.name, msg.err, strings.Join(keys_for("jobs"), ",")))
+	} else {
+		log.Printf("Job %d finished: %s", j.id, j.name)
+	}
+
+	// Forget the oldest finished jobs
+	finished := len(m.jobs) - m.runningJobs()
+	for i := 0; i < len(m.jobs) && finished > maxFinishedJobs; {
+		if m.jobs[i].running {
+			i++
+			continue
+		}
+		m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+		finished--
+	}
+
+	if msg.finish == nil {
+		return nil
+	}
+	return msg.finish(m)
+}
+
+// Shows the result of a job for command with show, unless the user left the
+// file list for something other than mode.  Then the result waits for command
+// to be run again with the same key, and the footer says it is ready.
+func (m *model) showWhenReady(command string, key string, mode int, show func(m *model)) {
+	if m.mode == commandMode || m.mode == mode {
+		delete(m.ready, command)
+		show(m)
+		return
+	}
+	if m.ready == nil {
+		m.ready = map[string]readyView{}
+	}
+	m.ready[command] = readyView{key, show}
+}
+
+// Shows the waiting result of command if it is for key.  Returns false if
+// there is none.
+func (m *model) showReady(command string, key string) bool {
+	r, found := m.ready[command]
+	if !found || r.key != key {
+		return false
+	}
+	delete(m.ready, command)
+	r.show(m)
+	return true
+}
+
+func (m *model) renderReadyStatus() string {
+	commands := []string{}
+	for command := range m.ready {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	status := ""
+	for _, command := range commands {
+		status += fmt.Sprintf(" %s ready (%s)", command, strings.Join(keys_for(command), ","))
+	}
+	if status == "" {
+		return ""
+	}
+	return rStats(status[1:])
+}
+
+func renderJobState(j *job) string {
+	if j.running {
+		return "running"
+	}
+	if errors.Is(j.err, context.Canceled) {
+		return "cancelled"
+	}
+	if j.err != nil {
+		return "failed"
+	}
+	return "done"
+}
+
+// Renders the log panel with the output of all jobs
+func (m *model) generateJobLog() string {
+	if len(m.jobs) == 0 {
+		return "  No background jobs have run\n"
+	}
+
+	doc := strings.Builder{}
+	for _, j := range m.jobs {
+		doc.WriteString(rSection(fmt.Sprintf("[%d] %s (%s)", j.id, j.name, renderJobState(j))) + "\n")
+		for _, line := range j.output {
+			doc.WriteString("  " + line + "\n")
+		}
+	}
+	return doc.String()
+}
+
+func (m *model) renderJobStatus() string {
+	running := m.runningJobs()
+	if running == 0 {
+		return ""
+	}
+
+	status := ""
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		if m.jobs[i].running {
+			status = m.jobs[i].name
+			if m.jobs[i].status != "" {
+				status += ": " + m.jobs[i].status
+			}
+			break
+		}
+	}
+	if running > 1 {
+		status = fmt.Sprintf("%s (+%d)", status, running-1)
+	}
+
+	return rStats(m.spinner.View() + " " + truncateFileName(status, Max(10, m.termWidth/3)))
+}
@@ -17,6 +17,7 @@ import (
 	//"runtime/debug"
 
 	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -63,6 +64,7 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 
 	var plugin_re = regexp.MustCompile(`^plugin ([^\s]+)( .*)?`)
 	var iplugin_re = regexp.MustCompile(`^iplugin ([^\s]+)( .*)?`)
+	var bplugin_re = regexp.MustCompile(`^bplugin ([^\s]+)( .*)?`)
 	// var run_re = regexp.MustCompile(`^run (.*)`)
 
 	switch msg := message.(type) {
@@ -71,6 +73,7 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 
 	case cdMsg:
 		dir := string(msg)
+		previous := ct.directory
 		err := ct.ChangeDirectory(dir)
 		if err != nil {
 			m.appendError("Error cding to " + dir + ".  Folder may have been removed.  Changing directory to root.")
@@ -79,6 +82,8 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			ct.AddHistory(dir)
 			m.viewport.SetContent(m.generateContent())
 			m.viewport.GotoTop()
+			m.checkScrollDown()
+			m.emitHook(onCd, nil, map[string]string{"previous_dir": previous})
 		}
 
 	case userErrorMsg:
@@ -92,7 +97,7 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			ct.historyIndex = -1
 			ct.ReRunFilter()
 			m.viewport.SetContent(m.generateContent())
-			m.viewport.GotoTop()
+			m.scrollToCursor()
 		} else if msg.errorMsg != "" {
 			m.appendError(msg.errorMsg)
 		}
@@ -134,6 +139,9 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	case bulkRenameFinishedMsg:
 		return m, m.FinishBulkRename(msg.tmppath, msg.src_names)
 
+	case chmodFinishedMsg:
+		return m, m.FinishEditPermissions(msg.tmppath, msg.entries)
+
 	case duplicateFinishedMsg:
 		return m, m.FinishDuplicate(string(msg))
 
@@ -143,10 +151,61 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	case refreshMsg:
 		return m.handleRefresh()
 
+	case hookFinishedMsg:
+		return m, m.handleHookFinished(msg)
+
+	case openWithMsg:
+		return m, m.OpenWith(msg.opener, msg.paths)
+
+	case archivePickedMsg:
+		return m, m.ArchiveFiles(msg.format, msg.paths)
+
+	case checksumPickedMsg:
+		return m, m.ChecksumFiles(msg.algorithm, msg.paths)
+
+	case extractPickedMsg:
+		return m, m.ExtractArchives(msg.where, msg.paths)
+
 	case deselectAllMsg:
 		m.DeselectAll()
 		return m, nil
 
+	case remoteMsg:
+		return m, m.handleRemote(msg)
+
+	case jobOutputMsg:
+		m.handleJobOutput(msg)
+		if m.mode == panelMode {
+			m.viewport.SetContent(m.generateContent())
+		}
+		return m, nil
+
+	case jobStatusMsg:
+		if j := m.findJob(msg.id); j != nil {
+			j.status = msg.status
+		}
+		return m, nil
+
+	case jobFinishedMsg:
+		cmd := m.handleJobFinished(msg)
+		if m.mode == panelMode {
+			m.viewport.SetContent(m.generateContent())
+		}
+		return m, cmd
+
+	case dirSizeMsg:
+		m.handleDirSize(msg)
+		return m, nil
+
+	case spinner.TickMsg:
+		// Let the tick loop stop when there is nothing to animate
+		if m.runningJobs() == 0 {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
 	case tea.KeyMsg:
 		if len(m.errors) > 0 {
 			// trash first error
@@ -159,6 +218,10 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		if m.mode == commandMode {
 			command := to_command(msg.String())
 			log.Printf("DEBUG: Key %s -> Command: %s", msg.String(), command)
+			if err := m.checkArchiveReadOnly(command); err != nil {
+				m.appendError(err.Error())
+				return m, nil
+			}
 			switch {
 
 			//Application
@@ -188,6 +251,21 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				m.mode = selectedMode
 				return m, refresh()
 
+			case command == "jobs":
+				m.mode = panelMode
+				m.panel = panel{title: "JOBS", render: (*model).generateJobLog}
+				m.viewport.SetContent(m.generateContent())
+				m.viewport.GotoBottom()
+				return m, nil
+			case command == "info":
+				m.ShowInfo()
+				return m, nil
+			case command == "cancel_job":
+				m.CancelJob()
+				return m, nil
+			case command == "du":
+				return m, m.Du()
+
 			// Filtering
 			case command == "filter":
 				m.mode = filterMode
@@ -234,11 +312,20 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 
 			case command == "enter_directory":
 				if m.isHoveredValid() {
-					if m.isHoveredDir() {
+					if m.isHoveredDir() || m.isHoveredArchive() {
 						return m, cd(m.getHoveredPath())
 					}
 				}
 
+			case command == "tree":
+				m.ToggleTree()
+				return m.handleRefresh()
+			case command == "expand":
+				m.ToggleExpand()
+				return m.handleRefresh()
+			case command == "flatten":
+				m.ToggleFlatten()
+
 			case command == "home":
 				usr, _ := user.Current()
 				return m, cd(usr.HomeDir)
@@ -251,31 +338,80 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			// Sorting
 			case command == "sort_name":
 				ct.SetSort(nameSort)
-				m.viewport.GotoTop()
+				m.scrollToCursor()
 			case command == "sort_modified":
 				ct.SetSort(modifiedSort)
-				m.viewport.GotoTop()
+				m.scrollToCursor()
 			case command == "sort_size":
 				ct.SetSort(sizeSort)
-				m.viewport.GotoTop()
+				m.scrollToCursor()
+			case command == "sort_natural":
+				ct.SetSort(naturalSort)
+				m.scrollToCursor()
+			case command == "sort_extension":
+				ct.SetSort(extensionSort)
+				m.scrollToCursor()
+			case command == "sort_created":
+				ct.SetSort(createdSort)
+				m.scrollToCursor()
+			case command == "sort_type":
+				ct.SetSort(typeSort)
+				m.scrollToCursor()
+			case command == "sort_reverse":
+				ct.ToggleSortReverse()
+				m.scrollToCursor()
+			case command == "sort_dirs_first":
+				ct.ToggleDirsFirst()
+				m.scrollToCursor()
+			case command == "sort_case":
+				ct.CycleSortCase()
+				m.scrollToCursor()
+			case command == "toggle_dir_sizes":
+				m.ToggleDirSizes()
 
 			// Selection
 			case command == "select":
 				m.ToggleSelected()
+				m.emitHook(onSelect, nil, map[string]string{"action": "select"})
 				m.MoveCursor(1)
 			case command == "select_all":
-				return m, m.SelectAll()
+				cmd := m.SelectAll()
+				m.emitHook(onSelect, nil, map[string]string{"action": "select_all"})
+				return m, cmd
 			case command == "deselect_all":
-				return m, m.DeselectAll()
+				cmd := m.DeselectAll()
+				m.emitHook(onSelect, []string{}, map[string]string{"action": "deselect_all"})
+				return m, cmd
 
 			// Operations
 			case command == "move":
 				return m, m.MoveFiles()
 			case command == "copy":
 				return m, m.CopyFiles()
+			case command == "link_symlink_absolute":
+				return m, m.LinkFiles(symlinkAbsolute)
+			case command == "link_symlink_relative":
+				return m, m.LinkFiles(symlinkRelative)
+			case command == "link_hard":
+				return m, m.LinkFiles(hardLink)
+			case command == "follow_link":
+				return m, m.FollowLink()
 
 			case command == "open":
 				return m, m.OpenFiles()
+			case command == "open_with":
+				return m, m.PickOpener()
+
+			case command == "archive":
+				return m, m.PickArchiveFormat()
+			case command == "extract":
+				return m, m.PickExtract()
+			case command == "checksum":
+				return m, m.Checksum()
+			case command == "find_duplicates":
+				return m, m.FindDuplicates()
+			case command == "compare":
+				return m, m.Compare()
 
 			case command == "edit":
 				if os.Getenv("TMUX") != "" {
@@ -295,12 +431,14 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				return m, m.RenameFile()
 			case command == "bulk_rename":
 				return m, m.BulkRename()
+			case command == "chmod":
+				return m, m.EditPermissions()
 
 			case command == "trash":
 				// https://github.com/morgant/tools-osx
 				return m, m.TrashFiles()
 			case command == "remove":
-				return m, m.RunInteractivePlugin(filepath.Join(home, ".config/bfm/plugins/remove"))
+				return m, m.RunInteractivePlugin(pluginPath(pluginBackedCommands["remove"]))
 				// return m, m.RemoveFiles()
 
 			// This may be used to force OneDrive to download a file so that it can be opened without error (like in Acrobat)
@@ -308,15 +446,13 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				return m, Run(false, ct.directory, "bash", "-c", fmt.Sprintf("cat '%s' > /dev/null", ct.filteredFiles[ct.cursor].Name()))
 
 			case command == "files": // Finder
-				// User may need to define an alias open for linux
-				return m, Run(false, ct.directory, "open", ct.directory)
+				return m, m.runOpener(defaultOpener(), ct.directory, []string{ct.directory})
 
 			case command == "shell": // Shell
 				if os.Getenv("TMUX") != "" {
 					return m, Run(false, ct.directory, "tmux", "new-window", "-n", "BASH", "bash")
 				} else {
-					home := os.Getenv("HOME")
-					return m, m.RunInteractivePlugin(filepath.Join(home, ".config/bfm/plugins/shell"))
+					return m, m.RunInteractivePlugin(pluginPath("shell"))
 				}
 			case command == "editor":
 				editor := os.Getenv("EDITOR")
@@ -331,9 +467,18 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				plugin := captures[1]
 				args := strings.Fields(captures[2])
 
-				home := os.Getenv("HOME")
-				plugin_path := filepath.Join(home, ".config/bfm/plugins", plugin)
-				return m, m.RunInteractivePlugin(plugin_path, args...)
+				return m, m.RunInteractivePlugin(pluginPath(plugin), args...)
+
+			case bplugin_re.MatchString(command):
+				captures := bplugin_re.FindStringSubmatch(command)
+				if captures == nil {
+					fmt.Printf("Plugin not specified in command %s\n", command)
+				}
+
+				plugin := captures[1]
+				args := strings.Fields(captures[2])
+
+				return m, m.RunBackgroundPlugin(pluginPath(plugin), args...)
 
 			case plugin_re.MatchString(command):
 				captures := plugin_re.FindStringSubmatch(command)
@@ -344,9 +489,7 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				plugin := captures[1]
 				args := strings.Fields(captures[2])
 
-				home := os.Getenv("HOME")
-				plugin_path := filepath.Join(home, ".config/bfm/plugins", plugin)
-				return m, m.RunPlugin(plugin_path, args...)
+				return m, m.RunPlugin(pluginPath(plugin), args...)
 
 			}
 			m.viewport.SetContent(m.generateContent())
@@ -478,8 +621,8 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 			ct.ReRunFilter()
-			m.viewport.GotoTop()
 			m.viewport.SetContent(m.generateContent())
+			m.scrollToCursor()
 		}
 
 		if m.mode == selectedMode {
@@ -523,6 +666,42 @@ func (m model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+		if m.mode == duMode {
+			return m, m.handleDuKey(msg.String())
+		}
+
+		if m.mode == dupsMode {
+			return m, m.handleDupKey(msg.String())
+		}
+
+		if m.mode == compareMode {
+			return m, m.handleCompareKey(msg.String())
+		}
+
+		if m.mode == panelMode {
+			switch msg.String() {
+			case "esc", "q":
+				m.mode = commandMode
+				return m, refresh()
+			case "j", "down":
+				m.viewport.LineDown(1)
+			case "k", "up":
+				m.viewport.LineUp(1)
+			case "ctrl+d":
+				m.viewport.HalfViewDown()
+			case "ctrl+u":
+				m.viewport.HalfViewUp()
+			case "g":
+				m.viewport.GotoTop()
+			case "G":
+				m.viewport.GotoBottom()
+			default:
+				if m.panel.keys != nil {
+					return m, m.panel.keys(&m, msg.String())
+				}
+			}
+		}
+
 	}
 
 	return m, nil
@@ -558,6 +737,13 @@ func getStartDir(args []string) string {
 }
 
 func main() {
+	if len(os.Args) > 2 && os.Args[1] == "--remote" {
+		os.Exit(RunRemote(strings.Join(os.Args[2:], " ")))
+	}
+	if len(os.Args) == 4 && os.Args[1] == "--du-export" {
+		os.Exit(RunDuExport(os.Args[2], os.Args[3]))
+	}
+
 	home = os.Getenv("HOME")
 	logpath := filepath.Join(home, ".local/log/bfm.log")
 	helpPath = filepath.Join(home, ".local/share/bfm/help-"+version+".txt")
@@ -575,6 +761,17 @@ func main() {
 	log.SetOutput(f)
 
 	LoadConfig()
+	showDirSizes = config.DirSizes
+	styleProblems := LoadTheme()
+	styleProblems = append(styleProblems, LoadFileStyles()...)
+	styleProblems = append(styleProblems, LoadIcons()...)
+	styleProblems = append(styleProblems, LoadColumns()...)
+	sortProblems := LoadSort()
+	sortProblems = append(sortProblems, LoadDirSettings()...)
+	openerProblems := LoadOpeners()
+	LoadDirStates()
+	startupProblems := RegisterPluginManifests()
+	startupProblems = append(startupProblems, CheckPlugins()...)
 
 	startDir := getStartDir(os.Args)
 
@@ -586,6 +783,7 @@ func main() {
 	m := model{}
 	for i := 0; i < 6; i++ {
 		m.tabs = append(m.tabs, tabData{active: false, showHidden: false})
+		m.tabs[i].setDefaultSort()
 	}
 
 	m.SelectTab(0)
@@ -595,11 +793,39 @@ func main() {
 	}
 	m.tabs[0].AddHistory(startDir)
 
+	if len(startupProblems) > 0 {
+		m.appendError("Problems found with plugins:\n\n" + strings.Join(startupProblems, "\n"))
+	}
+	if len(styleProblems) > 0 {
+		m.appendError("Problems found with styles:\n\n" + strings.Join(styleProblems, "\n"))
+	}
+	if len(sortProblems) > 0 {
+		m.appendError("Problems found with sort settings:\n\n" + strings.Join(sortProblems, "\n"))
+	}
+	if len(openerProblems) > 0 {
+		m.appendError("Problems found with openers:\n\n" + strings.Join(openerProblems, "\n"))
+	}
+
 	m.scrollProgress = progress.New(progress.WithScaledGradient("#FF7CCB", "#FDFF8C"))
+	m.spinner = spinner.New(spinner.WithSpinner(spinner.Dot), spinner.WithStyle(spinnerStyle))
 
 	// Create a new tea program and run it.
 	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithoutBracketedPaste())
+	program = p
+
+	closeRemote, err := ListenRemote(p)
+	if err != nil {
+		log.Printf("Error listening for remote commands: %s", err)
+	} else {
+		defer closeRemote()
+	}
+
+	// After listening, so on_start hooks can send commands to $BFM_SOCKET
+	m.emitHook(onStart, nil, nil)
+
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
 	}
+
+	WaitForHooks()
 }
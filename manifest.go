@@ -0,0 +1,250 @@
+// This file contains code for discovering plugin manifests so that plugins
+// dropped into ~/.config/bfm/plugins register themselves in help and bindings.
+//
+// A manifest is either a sidecar file (plugin.toml) next to the plugin or a
+// header in the plugin itself where each line starts with "# bfm:".
+//
+//	# bfm:section = "Operations"
+//	# bfm:help = "Open file(s) with Preview.app"
+//	# bfm:key = "P"
+//	# bfm:os = ["darwin"]
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const manifestPrefix = "# bfm:"
+
+// Manifest headers must appear in the first lines of the plugin
+const manifestMaxLines = 30
+
+var pluginCommandRe = regexp.MustCompile(`^([bi]?plugin) ([^\s]+)( .*)?`)
+
+// Built-in commands that are implemented by running a plugin
+var pluginBackedCommands = map[string]string{
+	"remove": "remove",
+}
+
+type PluginManifest struct {
+	Name        string   `toml:"name"`
+	Section     string   `toml:"section"`
+	Help        string   `toml:"help"`
+	Key         string   `toml:"key"`
+	Interactive bool     `toml:"interactive"`
+	Background  bool     `toml:"background"`
+	OS          []string `toml:"os"`
+}
+
+// Returns the command used in bindings to run the plugin
+func (pm PluginManifest) Command() string {
+	if pm.Interactive {
+		return "iplugin " + pm.Name
+	}
+	if pm.Background {
+		return "bplugin " + pm.Name
+	}
+	return "plugin " + pm.Name
+}
+
+// Returns true if the plugin supports the running operating system
+func (pm PluginManifest) Supported() bool {
+	if len(pm.OS) == 0 {
+		return true
+	}
+	return Contains(pm.OS, runtime.GOOS)
+}
+
+// Reads the manifest header from the top of the plugin.  Returns false if
+// the plugin does not have one.
+func readManifestHeader(path string) (PluginManifest, bool, error) {
+	var pm PluginManifest
+
+	file, err := os.Open(path)
+	if err != nil {
+		return pm, false, err
+	}
+	defer file.Close()
+
+	header := strings.Builder{}
+	scanner := bufio.NewScanner(file)
+	for i := 0; i < manifestMaxLines && scanner.Scan(); i++ {
+		line, found := strings.CutPrefix(scanner.Text(), manifestPrefix)
+		if found {
+			header.WriteString(line + "\n")
+		}
+	}
+
+	if header.Len() == 0 {
+		return pm, false, nil
+	}
+
+	_, err = toml.Decode(header.String(), &pm)
+	if err != nil {
+		return pm, false, err
+	}
+	return pm, true, nil
+}
+
+// Scans the plugin directory for manifests.  Problems found are returned so
+// they can be shown to the user.
+func ScanPluginManifests() ([]PluginManifest, []string) {
+	var manifests []PluginManifest
+	var problems []string
+
+	entries, err := os.ReadDir(pluginDir())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			problems = append(problems, "Error reading plugin directory: "+err.Error())
+		}
+		return manifests, problems
+	}
+
+	names := map[string]bool{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names[entry.Name()] = true
+		}
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, ".sh") {
+			continue
+		}
+
+		var pm PluginManifest
+
+		if pluginName, isSidecar := strings.CutSuffix(name, ".toml"); isSidecar {
+			if !names[pluginName] {
+				problems = append(problems, fmt.Sprintf("Plugin manifest %s has no plugin named %s", name, pluginName))
+				continue
+			}
+			if _, err := toml.DecodeFile(filepath.Join(pluginDir(), name), &pm); err != nil {
+				problems = append(problems, fmt.Sprintf("Error parsing plugin manifest %s: %s", name, err))
+				continue
+			}
+			if pm.Name == "" {
+				pm.Name = pluginName
+			}
+		} else {
+			if names[name+".toml"] {
+				// Sidecar takes precedence over the header
+				continue
+			}
+			var found bool
+			pm, found, err = readManifestHeader(filepath.Join(pluginDir(), name))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Error parsing manifest header of plugin %s: %s", name, err))
+				continue
+			}
+			if !found {
+				continue
+			}
+			if pm.Name == "" {
+				pm.Name = name
+			}
+		}
+
+		if !pm.Supported() {
+			log.Printf("Skipping plugin %s, not supported on %s", pm.Name, runtime.GOOS)
+			continue
+		}
+
+		manifests = append(manifests, pm)
+	}
+
+	return manifests, problems
+}
+
+// Adds plugins with manifests to help and bindings.  Plugins and bindings
+// in bfmrc take precedence.
+func RegisterPluginManifests() []string {
+	manifests, problems := ScanPluginManifests()
+
+	for _, pm := range manifests {
+		command := pm.Command()
+		log.Printf("Registering plugin %s from manifest", command)
+
+		registered := false
+		for _, plugin := range config.Plugins {
+			if plugin.Command == command {
+				registered = true
+				break
+			}
+		}
+		if !registered {
+			config.Plugins = append(config.Plugins, Plugin{
+				Section: pm.Section,
+				Command: command,
+				Help:    pm.Help,
+			})
+		}
+
+		if pm.Key == "" || len(keys_for(command)) > 0 {
+			continue
+		}
+		if to_command(pm.Key) != "none" {
+			log.Printf("Not binding %s to %s, already bound to %s", pm.Key, command, to_command(pm.Key))
+			continue
+		}
+		SetBinding(pm.Key, command)
+	}
+
+	return problems
+}
+
+// Reports plugins referenced by the config that are missing or not executable
+func CheckPlugins() []string {
+	var problems []string
+	checked := map[string]bool{}
+
+	check := func(command string) {
+		name := ""
+		if captures := pluginCommandRe.FindStringSubmatch(command); captures != nil {
+			name = captures[2]
+		} else if plugin, found := pluginBackedCommands[command]; found {
+			name = plugin
+		}
+
+		if name == "" || checked[name] {
+			return
+		}
+		checked[name] = true
+
+		path := pluginPath(name)
+		info, err := os.Stat(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Plugin %s is missing (%s)", name, path))
+			return
+		}
+		if !info.Mode().IsRegular() {
+			problems = append(problems, fmt.Sprintf("Plugin %s is not a file (%s)", name, path))
+			return
+		}
+		if info.Mode().Perm()&0111 == 0 {
+			problems = append(problems, fmt.Sprintf("Plugin %s is not executable (%s)", name, path))
+		}
+	}
+
+	for _, plugin := range config.Plugins {
+		check(plugin.Command)
+	}
+	for _, binding := range config.Bindings {
+		check(binding.Command)
+	}
+
+	return problems
+}
@@ -8,7 +8,9 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 type selectedFile struct {
@@ -17,10 +19,18 @@ type selectedFile struct {
 	file      fs.DirEntry
 }
 
+// Text shown in the viewport instead of the listing, like the log panel
+type panel struct {
+	title  string
+	render func(m *model) string
+	keys   func(m *model, key string) tea.Cmd // Keys besides scrolling, may be nil
+}
+
 type tabData struct {
 	active        bool
 	directory     string
 	absdir        string
+	archive       string // Path of the archive when listing one
 	files         []fs.DirEntry
 	filteredFiles []fs.DirEntry
 	cursor        int
@@ -29,7 +39,15 @@ type tabData struct {
 	filterHistory []string
 	historyIndex  int
 	sort          int
+	sortReverse   bool
+	dirsFirst     bool
+	sortCase      int
 	showHidden    bool
+	tree          bool
+	expanded      map[string][]fs.DirEntry // Directories expanded in tree mode, by path relative to directory
+	treeContext   map[string]bool          // Directories listed in tree mode only because files under them match the filter
+	flat          bool                     // Lists the files under directory (see flatten.go)
+	flatTruncated bool                     // The flat listing stopped at flattenMaxFiles
 
 	dirHistoryIndex int
 	dirHistory      []string
@@ -44,6 +62,19 @@ type model struct {
 	viewport       viewport.Model
 	scrollProgress progress.Model
 	viewportHeight int
+	spinner        spinner.Model
+
+	// Content shown in panelMode
+	panel panel
+
+	// Scan shown in duMode
+	du *duState
+
+	// Duplicates shown in dupsMode
+	dups *dupState
+
+	// Directories compared in compareMode
+	compare *compareState
 
 	// State Fields
 	CurrentTabIndex int
@@ -52,6 +83,13 @@ type model struct {
 	tabHistory      []int
 	selectedFiles   []selectedFile
 
+	// Background jobs that are running or recently finished
+	jobs      []*job
+	nextJobID int
+
+	// Results of jobs waiting to be shown, by command
+	ready map[string]readyView
+
 	// If an error has occurred, add to this slice and it will present it to the user
 	errors []string
 }
@@ -89,6 +127,20 @@ func (m *model) isHoveredDir() bool {
 	return false
 }
 
+// Returns the full paths of the selected files, or the hovered file if
+// none are selected
+func (m *model) targetPaths() []string {
+	var paths []string
+	if len(m.selectedFiles) != 0 {
+		for _, sf := range m.selectedFiles {
+			paths = append(paths, filepath.Join(sf.directory, sf.file.Name()))
+		}
+	} else if m.isHoveredValid() {
+		paths = append(paths, m.getHoveredPath())
+	}
+	return paths
+}
+
 // Returns the indicies of files selected in the directory of the current tab
 func (m *model) SelectedIndicies() []int {
 	indicies := []int{}
@@ -125,8 +177,15 @@ func (m *model) checkScrollUp() {
 	}
 }
 
+// Scrolls the viewport so the cursor is on screen
+func (m *model) scrollToCursor() {
+	m.checkScrollDown()
+	m.checkScrollUp()
+}
+
 // Returns index into selectedFiles if selected
 func (m *model) Selected(absdir string, file fs.DirEntry) int {
+	absdir, file = realEntry(absdir, file)
 	for i, sf := range m.selectedFiles {
 		if sf.directory != absdir {
 			continue
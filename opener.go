@@ -0,0 +1,299 @@
+// This file contains code for opening files with the applications
+// configured by [[openers]] in bfmrc.  Openers are matched by glob,
+// extension, or MIME type.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Replaced with the paths of the files being opened
+const openerPlaceholder = "{}"
+
+type openWithMsg struct {
+	opener string
+	paths  []string
+}
+
+// Files that match the same opener are opened together
+type openerGroup struct {
+	opener Opener
+	paths  []string
+}
+
+// Used when no opener matches a file
+func defaultOpener() Opener {
+	if runtime.GOOS == "darwin" {
+		return Opener{Name: "default", Command: "open --"}
+	}
+	// xdg-open only accepts one file at a time
+	return Opener{Name: "default", Command: "xdg-open", PerFile: true}
+}
+
+// Checks [[openers]] in bfmrc.  Openers are found by name for open_with
+// and fallbacks, so openers without a name or with a name already used are
+// dropped.  Returns the problems found.
+func LoadOpeners() []string {
+	problems := []string{}
+
+	openers := []Opener{}
+	names := map[string]bool{}
+	for _, o := range config.Openers {
+		if o.Name == "" {
+			problems = append(problems, "Opener without a name for "+o.Command)
+			continue
+		}
+		if o.Name == "default" {
+			problems = append(problems, "Opener named default, which is the name of the opener used when none match")
+			continue
+		}
+		if names[o.Name] {
+			problems = append(problems, "Opener "+o.Name+" is named more than once")
+			continue
+		}
+		names[o.Name] = true
+		openers = append(openers, o)
+	}
+	config.Openers = openers
+
+	return problems
+}
+
+// Returns true if the MIME type matches pattern, which may end in /*
+func mimeMatches(pattern, mimeType string) bool {
+	// Ignore parameters like charset
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	if prefix, found := strings.CutSuffix(pattern, "/*"); found {
+		return strings.HasPrefix(mimeType, prefix+"/")
+	}
+	return pattern == mimeType
+}
+
+// Returns true if the opener should be used for the file at path
+func (o Opener) Matches(path string) bool {
+	if len(o.Glob) == 0 && len(o.Extensions) == 0 && len(o.Mime) == 0 {
+		// Openers without rules match everything
+		return true
+	}
+
+	name := filepath.Base(path)
+	for _, glob := range o.Glob {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return true
+		}
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	for _, e := range o.Extensions {
+		if ext != "" && strings.TrimPrefix(strings.ToLower(e), ".") == ext {
+			return true
+		}
+	}
+
+	if len(o.Mime) > 0 {
+		mimeType := classifyPath(path).mime
+		for _, pattern := range o.Mime {
+			if mimeMatches(pattern, mimeType) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns true if the program run by the opener is installed
+func (o Opener) Available() bool {
+	fields := strings.Fields(o.Command)
+	if len(fields) == 0 {
+		return false
+	}
+	_, err := exec.LookPath(fields[0])
+	return err == nil
+}
+
+func findOpener(name string) (Opener, bool) {
+	for _, o := range config.Openers {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	if name == "default" {
+		return defaultOpener(), true
+	}
+	return Opener{}, false
+}
+
+// Follows the fallback chain until an opener that is installed is found
+func resolveOpener(o Opener, visited map[string]bool) (Opener, bool) {
+	if o.Available() {
+		return o, true
+	}
+	visited[o.Name] = true
+
+	for _, name := range o.Fallback {
+		if visited[name] {
+			continue
+		}
+		fallback, found := findOpener(name)
+		if !found {
+			log.Printf("Fallback opener %s of %s not found", name, o.Name)
+			continue
+		}
+		if resolved, ok := resolveOpener(fallback, visited); ok {
+			return resolved, true
+		}
+	}
+	return o, false
+}
+
+// Returns the opener for the file at path
+func openerFor(path string) Opener {
+	for _, o := range config.Openers {
+		if !o.Matches(path) {
+			continue
+		}
+		if resolved, ok := resolveOpener(o, map[string]bool{}); ok {
+			return resolved
+		}
+		log.Printf("Opener %s (and fallbacks) not installed", o.Name)
+	}
+	return defaultOpener()
+}
+
+// Returns all openers that match any of the paths
+func matchingOpeners(paths []string) []Opener {
+	var openers []Opener
+	for _, o := range config.Openers {
+		for _, path := range paths {
+			if o.Matches(path) {
+				openers = append(openers, o)
+				break
+			}
+		}
+	}
+	return append(openers, defaultOpener())
+}
+
+// Groups paths by the opener that will open them
+func groupByOpener(paths []string) []openerGroup {
+	var groups []openerGroup
+	for _, path := range paths {
+		o := openerFor(path)
+
+		found := false
+		for i := range groups {
+			if groups[i].opener.Name == o.Name {
+				groups[i].paths = append(groups[i].paths, path)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, openerGroup{o, []string{path}})
+		}
+	}
+	return groups
+}
+
+// Builds the shell command for the opener.  The paths are passed as
+// positional parameters so they do not need to be quoted.
+func (o Opener) shellCommand(paths []string) *exec.Cmd {
+	script := o.Command
+	if strings.Contains(script, openerPlaceholder) {
+		script = strings.ReplaceAll(script, openerPlaceholder, `"$@"`)
+	} else {
+		script += ` "$@"`
+	}
+
+	args := append([]string{"-c", script, "sh"}, paths...)
+	return exec.Command("sh", args...) //nolint:gosec
+}
+
+// Runs the opener on paths.  Interactive openers take over the terminal
+// while background openers are started without waiting for them to exit.
+func (m *model) runOpener(o Opener, dir string, paths []string) tea.Cmd {
+	invocations := [][]string{paths}
+	if o.PerFile {
+		invocations = [][]string{}
+		for _, path := range paths {
+			invocations = append(invocations, []string{path})
+		}
+	}
+
+	var cmds []tea.Cmd
+	for _, invocation := range invocations {
+		c := o.shellCommand(invocation)
+		c.Dir = dir
+		log.Printf("Opening %s with %s", strings.Join(invocation, ", "), o.Name)
+
+		if o.Interactive {
+			var stderr bytes.Buffer // Not used but required for runFinishedMsg
+			cmds = append(cmds, tea.ExecProcess(c, func(err error) tea.Msg {
+				return runFinishedMsg{false, o.Command, invocation, err, stderr}
+			}))
+			continue
+		}
+
+		var stderr bytes.Buffer
+		c.Stderr = &stderr
+
+		if err := c.Start(); err != nil {
+			m.appendError("Error opening " + strings.Join(invocation, ", ") + " with " + o.Name + ": " + err.Error())
+			continue
+		}
+		go func() {
+			if err := c.Wait(); err != nil {
+				log.Printf("Opener %s exited with error: %s", o.Name, err)
+				send(userErrorMsg(fmt.Sprintf("Error opening %s with %s: %s\n\n%s", strings.Join(invocation, ", "), o.Name, err, stderr.String())))
+			}
+		}()
+	}
+
+	return tea.Sequence(cmds...)
+}
+
+// Opens the paths with the opener chosen by the user with open_with
+func (m *model) OpenWith(name string, paths []string) tea.Cmd {
+	o, found := findOpener(name)
+	if !found {
+		m.appendError("No opener named " + name)
+		return nil
+	}
+	if resolved, ok := resolveOpener(o, map[string]bool{}); ok {
+		o = resolved
+	}
+
+	m.ClearSelections()
+	m.emitHook(onOperation, paths, map[string]string{"operation": "open"})
+	return tea.Sequence(m.runOpener(o, m.CurrentTab.absdir, paths), refresh())
+}
+
+// Lets the user pick from all the openers that match the files
+func (m *model) PickOpener() tea.Cmd {
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		m.appendError("No files to open")
+		return nil
+	}
+
+	var names []string
+	for _, o := range matchingOpeners(paths) {
+		if !Contains(names, o.Name) {
+			names = append(names, o.Name)
+		}
+	}
+
+	return PickWithFzf("Open with> ", names, func(name string) tea.Msg {
+		return openWithMsg{name, paths}
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/viewport"
@@ -35,6 +34,7 @@ func selectFile(name string) tea.Cmd {
 
 func (m *model) CloseTab() tea.Cmd {
 	ct := m.CurrentTab
+	ct.rememberDir()
 	ct.active = false
 	ct.filter = ""
 	ct.files = []fs.DirEntry{}
@@ -50,6 +50,8 @@ func (m *model) CloseTab() tea.Cmd {
 
 	if tabIndex == -1 {
 		m.writeLastd()
+		SaveDirStates()
+		m.emitHook(onQuit, []string{}, nil)
 		return tea.Quit
 	} else {
 		// We Select tab *number* here
@@ -87,6 +89,22 @@ func (td *tabData) SetSort(sort int) {
 	td.SetFilter("")
 }
 
+func (td *tabData) ToggleSortReverse() {
+	td.sortReverse = !td.sortReverse
+	td.SetFilter("")
+}
+
+func (td *tabData) ToggleDirsFirst() {
+	td.dirsFirst = !td.dirsFirst
+	td.SetFilter("")
+}
+
+// Cycles between case sensitive, case insensitive, and locale name order
+func (td *tabData) CycleSortCase() {
+	td.sortCase = (td.sortCase + 1) % len(caseNames)
+	td.SetFilter("")
+}
+
 func (m *model) MoveCursor(linesDown int) {
 	ct := m.CurrentTab
 
@@ -164,12 +182,17 @@ func (m *model) GoHistoryBack() tea.Cmd {
 
 	//log.Printf("Changing to %s di: %d dhl: %d", dir, ct.dirHistoryIndex, len(ct.dirHistory))
 
+	previous := ct.directory
 	err := ct.ChangeDirectory(dir)
 	if err != nil {
 		parent := filepath.Dir(dir)
 		m.appendError("Error getting contents of " + dir + ".  Folder may have been removed.  Changing directory to " + parent + ".")
 		return cd(parent)
 	}
+	m.viewport.SetContent(m.generateContent())
+	m.viewport.GotoTop()
+	m.checkScrollDown()
+	m.emitHook(onCd, nil, map[string]string{"previous_dir": previous})
 	return refresh()
 }
 
@@ -185,12 +208,17 @@ func (m *model) GoHistoryForward() tea.Cmd {
 
 	//log.Printf("Changing to %s di: %d dhl: %d", dir, ct.dirHistoryIndex, len(ct.dirHistory))
 
+	previous := ct.directory
 	err := ct.ChangeDirectory(dir)
 	if err != nil {
 		parent := filepath.Dir(dir)
 		m.appendError("Error getting contents of " + dir + ".  Folder may have been removed.  Changing directory to " + parent + ".")
 		return cd(parent)
 	}
+	m.viewport.SetContent(m.generateContent())
+	m.viewport.GotoTop()
+	m.checkScrollDown()
+	m.emitHook(onCd, nil, map[string]string{"previous_dir": previous})
 
 	return refresh()
 }
@@ -233,6 +261,12 @@ func (m *model) MovePrevSelected() {
 }
 
 func (td *tabData) filterFiles() {
+	td.treeContext = nil
+	if td.tree {
+		td.filterTree()
+		return
+	}
+
 	td.filteredFiles = []fs.DirEntry{}
 	var candidates []string
 	for _, f := range td.files {
@@ -253,34 +287,54 @@ func (td *tabData) filterFiles() {
 	} else {
 		parsedQuery := ParseQuery(td.filter)
 		for _, name := range candidates {
-			if parsedQuery.Eval(name) > 0 {
+			if parsedQuery.EvalFile(td.absdir, nameToEntry[name]) > 0 {
 				td.filteredFiles = append(td.filteredFiles, nameToEntry[name])
 			}
 		}
 	}
 
-	if td.sort == nameSort {
-		sort.Sort(ByName(td.filteredFiles))
-	}
-	if td.sort == modifiedSort {
-		sort.Sort(ByMod(td.filteredFiles))
-	}
-	if td.sort == sizeSort {
-		sort.Sort(BySize(td.filteredFiles))
-	}
+	td.sortFiles(td.filteredFiles)
 }
 
 func (td *tabData) SetFilter(filter string) {
 	td.filter = filter
-	td.filterFiles()
-	td.cursor = 0
+	td.ReRunFilter()
 }
 
+// Filters and sorts the files again.  The cursor stays on the hovered file,
+// or moves to its nearest neighbor if the file is no longer listed.
 func (td *tabData) ReRunFilter() {
+	previous := td.filteredFiles
+	cursor := td.cursor
 	td.filterFiles()
+	td.followCursor(previous, cursor)
+}
+
+// Moves the cursor to the file at cursor in previous, or to the closest file
+// to it that is still listed.  Files below are preferred to files above.
+func (td *tabData) followCursor(previous []fs.DirEntry, cursor int) {
+	index := map[string]int{}
+	for i, f := range td.filteredFiles {
+		index[f.Name()] = i
+	}
+
+	for d := 0; cursor+d < len(previous) || cursor-d >= 0; d++ {
+		for _, i := range []int{cursor + d, cursor - d} {
+			if i < 0 || i >= len(previous) {
+				continue
+			}
+			if found, ok := index[previous[i].Name()]; ok {
+				td.cursor = found
+				return
+			}
+		}
+	}
+
+	td.cursor = Max(0, Min(len(td.filteredFiles)-1, cursor))
 }
 
 func (m *model) Select(absdir string, file fs.DirEntry) {
+	absdir, file = realEntry(absdir, file)
 	m.selectedFiles = append(m.selectedFiles, selectedFile{directory: absdir, file: file})
 }
 
@@ -303,6 +357,10 @@ func (m *model) DeselectAll() tea.Cmd {
 func (m *model) SelectAll() tea.Cmd {
 	ct := m.CurrentTab
 	for _, f := range ct.filteredFiles {
+		if ct.treeContext[f.Name()] {
+			// Only listed to show where matching files are
+			continue
+		}
 		i := m.Selected(ct.absdir, f)
 		if i == -1 {
 			m.Select(ct.absdir, f)
@@ -1,75 +1,330 @@
+// This file contains the sort orders of the listing.  The keys of every file
+// are computed once before sorting, so files that vanish while the listing
+// is sorted get zero keys instead of stopping bfm.
+
 package main
 
 import (
-	"log"
+	"cmp"
+	"fmt"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// How names are compared
+const (
+	caseSensitive   = iota // Byte order, so uppercase before lowercase
+	caseInsensitive = iota
+	caseLocale      = iota // The collation of the user's language, from LANG
 )
 
-// ByName implements sort.Interface for []DirEntry based on the Name() field.
-type ByName []fs.DirEntry
+// Names are used by [sort] in bfmrc
+var sortNames = map[int]string{
+	modifiedSort:  "modified",
+	nameSort:      "name",
+	sizeSort:      "size",
+	naturalSort:   "natural",
+	extensionSort: "extension",
+	createdSort:   "created",
+	typeSort:      "type",
+}
+
+var sortBadges = map[int]string{
+	modifiedSort:  "MOD",
+	nameSort:      "NAM",
+	sizeSort:      "SIZ",
+	naturalSort:   "NAT",
+	extensionSort: "EXT",
+	createdSort:   "CRE",
+	typeSort:      "TYP",
+}
+
+var caseNames = map[int]string{
+	caseSensitive:   "sensitive",
+	caseInsensitive: "insensitive",
+	caseLocale:      "locale",
+}
+
+// The sort of new tabs, set by LoadSort
+var defaultSort = tabData{sort: modifiedSort}
+
+// Returns the key of the name in m, or false if there is none
+func lookupName(m map[int]string, name string) (int, bool) {
+	for key, n := range m {
+		if n == name {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+// Checks [sort] in bfmrc.  Returns the problems found.
+func LoadSort() []string {
+	problems := []string{}
+
+	defaultSort = tabData{sort: modifiedSort}
+	if config.Sort.By != "" {
+		if by, found := lookupName(sortNames, config.Sort.By); found {
+			defaultSort.sort = by
+		} else {
+			problems = append(problems, "Unknown sort "+config.Sort.By)
+		}
+	}
+	if config.Sort.Case != "" {
+		if nameCase, found := lookupName(caseNames, config.Sort.Case); found {
+			defaultSort.sortCase = nameCase
+		} else {
+			problems = append(problems, "Unknown sort case "+config.Sort.Case)
+		}
+	}
+	defaultSort.sortReverse = config.Sort.Reverse
+	defaultSort.dirsFirst = config.Sort.DirsFirst
+
+	return problems
+}
+
+// Sets the sort of the tab to the one in bfmrc
+func (td *tabData) setDefaultSort() {
+	td.sort = defaultSort.sort
+	td.sortReverse = defaultSort.sortReverse
+	td.dirsFirst = defaultSort.dirsFirst
+	td.sortCase = defaultSort.sortCase
+}
+
+// The language names are collated in, from the locale like LANG=de_DE.UTF-8.
+// Locales that are not languages, like C, use the root collation.
+var collateLanguage = func() language.Tag {
+	for _, env := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		value, _, _ = strings.Cut(value, ".")
+		value, _, _ = strings.Cut(value, "@")
+		if tag, err := language.Parse(strings.ReplaceAll(value, "_", "-")); err == nil {
+			return tag
+		}
+		break
+	}
+	return language.Und
+}()
+
+// Returns a function that returns the name as it is compared with nameCase.
+// With caseLocale it is a collation key, in which digits compare by value
+// for natural sorts.
+func nameFolder(nameCase int, natural bool) func(name string) string {
+	switch nameCase {
+	case caseInsensitive:
+		return strings.ToLower
+	case caseLocale:
+		options := []collate.Option{}
+		if natural {
+			options = append(options, collate.Numeric)
+		}
+		collator := collate.New(collateLanguage, options...)
+		buf := &collate.Buffer{}
+		return func(name string) string {
+			key := string(collator.KeyFromString(buf, name))
+			buf.Reset()
+			return key
+		}
+	}
+	return func(name string) string { return name }
+}
 
-// sort.Interface requires Len, Swap and Less
-func (a ByName) Len() int {
-	return len(a)
+// Compares a and b with runs of digits compared by their value, so file2
+// sorts before file10
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		ai, bi := digitRun(a), digitRun(b)
+		if ai > 0 && bi > 0 {
+			// Compare numbers by length without leading zeros, then by digits
+			an, bn := strings.TrimLeft(a[:ai], "0"), strings.TrimLeft(b[:bi], "0")
+			if len(an) != len(bn) {
+				return cmp.Compare(len(an), len(bn))
+			}
+			if c := strings.Compare(an, bn); c != 0 {
+				return c
+			}
+			a, b = a[ai:], b[bi:]
+			continue
+		}
+		if a[0] != b[0] {
+			return cmp.Compare(a[0], b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
 }
 
-func (a ByName) Swap(i, j int) {
-	a[i], a[j] = a[j], a[i]
+// Returns the length of the run of digits at the start of s
+func digitRun(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
 }
 
-func (a ByName) Less(i, j int) bool {
-	return a[i].Name() < a[j].Name()
+// What files are compared by, computed once per sort
+type sortKey struct {
+	name     string
+	folded   string
+	isDir    bool
+	time     time.Time
+	size     int64
+	ext      string
+	category fileCategory
 }
 
-// ByMod implements sort.Interface for []DirEntry based on the Name() field.
-type ByMod []fs.DirEntry
+// fileSorter implements sort.Interface for DirEntries and their keys
+type fileSorter struct {
+	entries   []fs.DirEntry
+	keys      []sortKey
+	sort      int
+	reverse   bool
+	dirsFirst bool
+	natural   bool
+	collated  bool // Folded names are collation keys, which are compared as is
+}
 
-// sort.Interface requires Len, Swap and Less
-func (a ByMod) Len() int {
-	return len(a)
+func (s fileSorter) Len() int {
+	return len(s.entries)
 }
 
-func (a ByMod) Swap(i, j int) {
-	a[i], a[j] = a[j], a[i]
+func (s fileSorter) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
 }
 
-func (a ByMod) Less(i, j int) bool {
-	iinfo, err := a[i].Info()
-	if err != nil {
-		log.Printf("Error getting ModTime of %s: %s", a[i].Name(), err)
-		return true
+func (s fileSorter) compareNames(a, b *sortKey) int {
+	c := 0
+	if s.natural && !s.collated {
+		c = compareNatural(a.folded, b.folded)
+	} else {
+		c = strings.Compare(a.folded, b.folded)
 	}
-	jinfo, err := a[j].Info()
-	if err != nil {
-		log.Printf("Error getting ModTime of %s: %s", a[j].Name(), err)
-		return false
+	if c == 0 {
+		c = strings.Compare(a.name, b.name)
 	}
-	// Last Modified First
-	return iinfo.ModTime().After(jinfo.ModTime())
+	return c
 }
 
-// BySize implements sort.Interface for []DirEntry based on the Name() field.
-type BySize []fs.DirEntry
+func (s fileSorter) Less(i, j int) bool {
+	a, b := &s.keys[i], &s.keys[j]
 
-// sort.Interface requires Len, Swap and Less
-func (a BySize) Len() int {
-	return len(a)
+	// Directories stay first when the order is reversed
+	if s.dirsFirst && a.isDir != b.isDir {
+		return a.isDir
+	}
+
+	c := 0
+	switch s.sort {
+	case modifiedSort, createdSort:
+		// Newest first
+		c = b.time.Compare(a.time)
+	case sizeSort:
+		c = cmp.Compare(a.size, b.size)
+	case extensionSort:
+		c = strings.Compare(a.ext, b.ext)
+	case typeSort:
+		c = cmp.Compare(int(a.category), int(b.category))
+		if c == 0 {
+			c = strings.Compare(a.ext, b.ext)
+		}
+	}
+	if c == 0 {
+		c = s.compareNames(a, b)
+	}
+
+	if s.reverse {
+		return c > 0
+	}
+	return c < 0
 }
 
-func (a BySize) Swap(i, j int) {
-	a[i], a[j] = a[j], a[i]
+// Sorts the files of the tab, which are in the tab's directory
+func (td *tabData) sortFiles(files []fs.DirEntry) {
+	s := fileSorter{
+		entries:   files,
+		keys:      make([]sortKey, len(files)),
+		sort:      td.sort,
+		reverse:   td.sortReverse,
+		dirsFirst: td.dirsFirst,
+		natural:   td.sort == naturalSort,
+		collated:  td.sortCase == caseLocale,
+	}
+	fold := nameFolder(td.sortCase, s.natural)
+
+	for i, f := range files {
+		key := &s.keys[i]
+		key.name = f.Name()
+		key.folded = fold(f.Name())
+		key.isDir = f.IsDir() || (s.dirsFirst && isSymDir(td.absdir, f))
+
+		switch td.sort {
+		case modifiedSort:
+			if info, err := f.Info(); err == nil {
+				key.time = info.ModTime()
+			}
+		case createdSort:
+			key.time = createdTime(td.absdir, f)
+		case sizeSort:
+			key.size, _ = fileSize(td.absdir, f)
+		case extensionSort:
+			key.ext = fileExtension(f.Name())
+		case typeSort:
+			key.category = classify(td.absdir, f).category
+			key.ext = fileExtension(f.Name())
+		}
+	}
+
+	sort.Sort(s)
 }
 
-func (a BySize) Less(i, j int) bool {
-	iinfo, err := a[i].Info()
-	if err != nil {
-		log.Fatalf("Error getting ModTime of %s: %s", a[i].Name(), err)
+// Returns when the file f in dir was created.  Files without a birth time
+// use their modification time.
+func createdTime(dir string, f fs.DirEntry) time.Time {
+	if t, ok := birthTime(filepath.Join(dir, f.Name())); ok {
+		return t
 	}
-	jinfo, err := a[j].Info()
-	if err != nil {
-		log.Fatalf("Error getting ModTime of %s: %s", a[j].Name(), err)
+	if info, err := f.Info(); err == nil {
+		return info.ModTime()
 	}
-	return iinfo.Size() < jinfo.Size()
+	return time.Time{}
 }
 
+// Returns the footer badge for the sort of the tab.  Directories first adds
+// "/" before the order, and the flags after "-" are i for case insensitive,
+// L for locale, and R for reverse.
+func (td *tabData) sortBadge() string {
+	badge, found := sortBadges[td.sort]
+	if !found {
+		badge = fmt.Sprintf("%d", td.sort)
+	}
+	if td.dirsFirst {
+		badge = "/" + badge
+	}
 
+	flags := ""
+	switch td.sortCase {
+	case caseInsensitive:
+		flags += "i"
+	case caseLocale:
+		flags += "L"
+	}
+	if td.sortReverse {
+		flags += "R"
+	}
+	if flags != "" {
+		badge += "-" + flags
+	}
+	return badge
+}
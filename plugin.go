@@ -4,14 +4,29 @@ import (
 	"bytes"
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"log"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// Returns the directory where plugins are installed
+func pluginDir() string {
+	return filepath.Join(home, ".config/bfm/plugins")
+}
+
+// Returns the path of the plugin named name
+func pluginPath(name string) string {
+	return filepath.Join(pluginDir(), name)
+}
+
 func (m *model) writeState() string {
 	ct := m.CurrentTab
 
@@ -209,3 +224,105 @@ func (m *model) runPluginCommands(f string) tea.Cmd {
 
 	return tea.Sequence(teaCmds...)
 }
+
+// How often the footer shows the latest line from a background plugin
+const pluginStatusInterval = 100 * time.Millisecond
+
+// Lines longer than this from a background plugin are split
+const maxPluginLine = 1024 * 1024
+
+// Splits output into lines at \n or \r, so progress bars redrawn with \r
+// show up as they are drawn
+func scanOutputLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if (atEOF && len(data) > 0) || len(data) >= maxPluginLine {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Runs the plugin in the background while its output is streamed to the
+// log panel.  The cmd file is applied when the plugin exits.  Cancelling
+// kills the plugin and every program it started.
+func (m *model) RunBackgroundPlugin(pluginpath string, args ...string) tea.Cmd {
+	log.Printf("Running Background Plugin %s", pluginpath)
+	statepath := m.writeState()
+	cmdpath := m.createCmd()
+
+	args = append([]string{cmdpath}, args...)   // $2
+	args = append([]string{statepath}, args...) // $1
+
+	return m.StartJob(filepath.Base(pluginpath), func(h *jobHandle) (func(m *model) tea.Cmd, error) {
+		finish := func(m *model) tea.Cmd {
+			tea_cmds := m.runPluginCommands(cmdpath)
+
+			os.Remove(statepath)
+			os.Remove(cmdpath)
+
+			return tea_cmds
+		}
+
+		c := exec.CommandContext(h.ctx, pluginpath, args...) //nolint:gosec
+		// The plugin gets its own process group so that cancelling kills the
+		// programs it runs too, which would otherwise hold its output open
+		c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		c.Cancel = func() error {
+			return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		}
+		c.WaitDelay = time.Second
+
+		// Both go to one pipe, so their lines stay in order
+		output, w := io.Pipe()
+		c.Stdout = w
+		c.Stderr = w
+
+		if err := c.Start(); err != nil {
+			return finish, err
+		}
+
+		var latest atomic.Pointer[string] // Line to show in the footer next
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			scanner := bufio.NewScanner(output)
+			scanner.Buffer(make([]byte, 64*1024), maxPluginLine)
+			scanner.Split(scanOutputLines)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if line != "" {
+					h.Log(line)
+					latest.Store(&line)
+				}
+			}
+			// Keep reading so the plugin does not block writing
+			io.Copy(io.Discard, output)
+		}()
+
+		// The footer shows the latest line now and then, not every line
+		go func() {
+			ticker := time.NewTicker(pluginStatusInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if line := latest.Swap(nil); line != nil {
+						h.Status(*line)
+					}
+				}
+			}
+		}()
+
+		err := c.Wait()
+		w.Close()
+		<-done
+		if h.Cancelled() {
+			// Killed by cancelling, which is not an error of the plugin
+			return finish, nil
+		}
+		return finish, err
+	})
+}
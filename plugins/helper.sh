@@ -8,7 +8,11 @@ read_state() {
 
     PATHS=()
     while IFS= read -r P; do
-        PATHS+=("$P")
+        case "$P" in
+            # Hooks append details about the event (BFM_EVENT=on_cd)
+            BFM_*=*) export "$P" ;;
+            *) PATHS+=("$P") ;;
+        esac
     done
 }
 
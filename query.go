@@ -3,6 +3,7 @@ package main
 import (
 	"bfm/fzf/algo"
 	"bfm/fzf/util"
+	"io/fs"
 	"strings"
 )
 
@@ -15,6 +16,7 @@ const (
 	termPrefix
 	termSuffix
 	termEqual
+	termClass // @image or @image/png matches the file's category or MIME type
 )
 
 type Term struct {
@@ -57,6 +59,9 @@ func parseTerm(s string, caseSensitive bool) Term {
 		typ = termExact
 		s = s[1:]
 	}
+	if len(s) > 1 && strings.HasPrefix(s, "@") {
+		return Term{Pattern: s[1:], Type: termClass, Inverse: inv, CaseSensitive: caseSensitive}
+	}
 	if s != "$" && strings.HasSuffix(s, "$") {
 		typ = termSuffix
 		s = s[:len(s)-1]
@@ -80,10 +85,32 @@ func parseTerm(s string, caseSensitive bool) Term {
 }
 
 func (q *Query) Eval(text string) int {
+	return q.eval(text, func() fileClass { return fileClass{categoryUnknown, ""} })
+}
+
+// Like Eval, but @ terms are matched against the classification of f
+func (q *Query) EvalFile(dir string, f fs.DirEntry) int {
+	var class *fileClass
+	return q.eval(f.Name(), func() fileClass {
+		// Only classify if there is a term that needs it
+		if class == nil {
+			c := classify(dir, f)
+			class = &c
+		}
+		return *class
+	})
+}
+
+func (q *Query) eval(text string, class func() fileClass) int {
 	chars := util.RunesToChars([]rune(text))
 	score := 0
 	for _, term := range q.Terms {
-		termScore := q.evalTerm(term, &chars)
+		var termScore int
+		if term.Type == termClass {
+			termScore = evalClassTerm(term, class())
+		} else {
+			termScore = q.evalTerm(term, &chars)
+		}
 		if q.Or {
 			if termScore > 0 {
 				score = termScore
@@ -140,3 +167,17 @@ func (q *Query) evalTerm(term Term, chars *util.Chars) int {
 	}
 	return score
 }
+
+func evalClassTerm(term Term, class fileClass) int {
+	matched := false
+	if strings.Contains(term.Pattern, "/") {
+		matched = mimeMatches(strings.ToLower(term.Pattern), class.mime)
+	} else {
+		matched = strings.ToLower(term.Pattern) == class.category.String()
+	}
+
+	if matched != term.Inverse {
+		return 1
+	}
+	return 0
+}
@@ -185,3 +185,29 @@ func (m *model) HandlePluginRunError(msg runPluginFinishedMsg) tea.Cmd {
 	return Run(true, tmpdir, "bash", "-c", fmt.Sprintf("LESS=IR less '%s'; rm '%s'", t.Name(), t.Name()))
 }
 
+
+// Lets the user pick one of options with fzf.  onPick is only called if an
+// option was picked.
+func PickWithFzf(prompt string, options []string, onPick func(string) tea.Msg) tea.Cmd {
+	c := exec.Command("fzf", "--prompt", prompt)
+	c.Stdin = strings.NewReader(strings.Join(options, "\n"))
+
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok && (exitErr.ExitCode() == 130 || exitErr.ExitCode() == 1) {
+				// cancellation, no error
+				return nil
+			}
+			return userErrorMsg("fzf error: " + err.Error())
+		}
+
+		selected := strings.TrimSpace(stdout.String())
+		if selected == "" {
+			return nil
+		}
+		return onPick(selected)
+	})
+}
@@ -0,0 +1,203 @@
+// This file contains the remote control API.  Each bfm instance listens on a
+// Unix socket (exported to child processes as $BFM_SOCKET) that accepts the
+// same commands as the plugin cmd file plus queries answered in JSON.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Set in main so that goroutines can deliver messages into the bubbletea loop
+var program *tea.Program
+
+// Delivered to Update so that the model is only touched from the bubbletea loop
+type remoteMsg struct {
+	command string
+	reply   chan remoteReply
+}
+
+type remoteReply struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	Data  any    `json:"data,omitempty"`
+}
+
+type remoteTab struct {
+	Number    int    `json:"number"`
+	Active    bool   `json:"active"`
+	Current   bool   `json:"current"`
+	Directory string `json:"directory"`
+	Filter    string `json:"filter"`
+}
+
+// Returns the path of the socket for this instance
+func socketPath() string {
+	tmpdir := os.Getenv("TMPDIR")
+	if tmpdir == "" {
+		tmpdir = os.TempDir()
+	}
+	return filepath.Join(tmpdir, fmt.Sprintf("bfm-%d.sock", os.Getpid()))
+}
+
+// Starts listening on the socket and exports $BFM_SOCKET.  The returned
+// function closes the listener and removes the socket.
+func ListenRemote(p *tea.Program) (func(), error) {
+	path := socketPath()
+	os.Remove(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	os.Setenv("BFM_SOCKET", path)
+	log.Printf("Listening for remote commands on %s", path)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Printf("Error accepting remote connection: %s", err)
+				}
+				return
+			}
+			go handleRemote(p, conn)
+		}
+	}()
+
+	return func() {
+		l.Close()
+		os.Remove(path)
+	}, nil
+}
+
+// Reads one command per line and writes one JSON reply per line
+func handleRemote(p *tea.Program, conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" {
+			continue
+		}
+		log.Printf("Remote command: %s", command)
+
+		reply := make(chan remoteReply, 1)
+		p.Send(remoteMsg{command, reply})
+
+		if err := encoder.Encode(<-reply); err != nil {
+			log.Printf("Error writing remote reply: %s", err)
+			return
+		}
+	}
+}
+
+// Called by Update to answer a query or convert a command into a tea.Cmd
+func (m *model) handleRemote(msg remoteMsg) tea.Cmd {
+	if query, ok := strings.CutPrefix(msg.command, "query "); ok {
+		data, err := m.remoteQuery(strings.TrimSpace(query))
+		if err != nil {
+			msg.reply <- remoteReply{Error: err.Error()}
+		} else {
+			msg.reply <- remoteReply{Ok: true, Data: data}
+		}
+		return nil
+	}
+
+	teaCmd := m.toTeaCmd(msg.command)
+	if teaCmd == nil {
+		msg.reply <- remoteReply{Error: "unknown command: " + msg.command}
+		return nil
+	}
+
+	msg.reply <- remoteReply{Ok: true}
+	return teaCmd
+}
+
+func (m *model) remoteQuery(query string) (any, error) {
+	ct := m.CurrentTab
+
+	switch query {
+	case "dir":
+		return ct.absdir, nil
+
+	case "hovered":
+		if !m.isHoveredValid() {
+			return "", nil
+		}
+		return m.getHoveredPath(), nil
+
+	case "selection":
+		paths := []string{}
+		for _, sf := range m.selectedFiles {
+			paths = append(paths, filepath.Join(sf.directory, sf.file.Name()))
+		}
+		return paths, nil
+
+	case "tabs":
+		tabs := []remoteTab{}
+		for i, tab := range m.tabs {
+			tabs = append(tabs, remoteTab{
+				Number:    i + 1,
+				Active:    tab.active,
+				Current:   i == m.CurrentTabIndex,
+				Directory: tab.directory,
+				Filter:    tab.filter,
+			})
+		}
+		return tabs, nil
+	}
+
+	return nil, errors.New("unknown query: " + query)
+}
+
+// Client mode: sends command to the instance listening on $BFM_SOCKET and
+// prints the reply.  Returns the exit status for the process.
+func RunRemote(command string) int {
+	path := os.Getenv("BFM_SOCKET")
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "BFM_SOCKET is not set")
+		return 1
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to %s: %s\n", path, err)
+		return 1
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending command: %s\n", err)
+		return 1
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading reply: %s\n", err)
+		return 1
+	}
+
+	os.Stdout.Write(line)
+
+	var reply remoteReply
+	if err := json.Unmarshal(line, &reply); err != nil || !reply.Ok {
+		return 1
+	}
+	return 0
+}
@@ -1,58 +1,237 @@
 package main
 
 import (
-	"io/fs"
-	"os"
-	"strings"
-
 	"github.com/charmbracelet/lipgloss"
 )
 
-var (
-	subtleColor = lipgloss.AdaptiveColor{Light: "#D9DCCF", Dark: "#383838"}
-	cursorBgColor = subtleColor
+// Colors by name.  Themes may override any of them (see theme.go).
+var defaultColors = map[string]lipgloss.AdaptiveColor{
+	"subtle": {Light: "#D9DCCF", Dark: "#383838"},
 
-	headingBarBg = subtleColor
-	statusBarBg = subtleColor
+	//"selected":    {Light: "#DDDDDD", Dark: "#222222"},
+	//"selected_bg": {Light: "#222222", Dark: "#98bb6c"},
+	"selected":    {Light: "#DDDDDD", Dark: "#222222"},
+	"selected_bg": {Light: "#222222", Dark: "#55a600"},
 
-	//selectedColor = lipgloss.AdaptiveColor{Light: "#DDDDDD", Dark: "#222222"}
-	//selectedBgColor = lipgloss.AdaptiveColor{Light: "#222222", Dark: "#98bb6c"}
-	selectedColor = lipgloss.AdaptiveColor{Light: "#DDDDDD", Dark: "#222222"}
-	selectedBgColor = lipgloss.AdaptiveColor{Light: "#222222", Dark: "#55a600"}
-	selStatsBgColor = selectedBgColor
+	"active":   {Light: "#222222", Dark: "#EEEEEE"},
+	"inactive": {Light: "#EEEEEE", Dark: "#555555"},
 
-	activeColor = lipgloss.AdaptiveColor{Light: "#222222", Dark: "#EEEEEE"}
-	inactiveColor = lipgloss.AdaptiveColor{Light: "#EEEEEE", Dark: "#555555"}
+	"status": {Light: "#0c0c0c", Dark: "#0c0c0c"},
 
-	statusColor = lipgloss.AdaptiveColor{Light: "#0c0c0c", Dark: "#0c0c0c"}
+	"white":        {Light: "#333", Dark: "#BBB"},
+	"bright_white": {Light: "#000", Dark: "#FFF"},
 
-	whiteColor = lipgloss.AdaptiveColor{Light: "#333", Dark: "#BBB"}
-	brightWhiteColor = lipgloss.AdaptiveColor{Light: "#000", Dark: "#FFF"}
+	"command_bg": {Light: "#b341e7", Dark: "#b341e7"},
+	"filter_bg":  {Light: "#ff4d86", Dark: "#ff4d86"},
+	"sort_bg":    {Light: "#6d00e8", Dark: "#6d00e8"},
+	"help_bg":    {Light: "#b341e7", Dark: "#b341e7"},
 
-	commandBgColor = lipgloss.AdaptiveColor{Light: "#b341e7", Dark: "#b341e7"}
-	filterBgColor = lipgloss.AdaptiveColor{Light: "#ff4d86", Dark: "#ff4d86"}
-	sortBgColor = lipgloss.AdaptiveColor{Light: "#6d00e8", Dark: "#6d00e8"}
-	helpBgColor = lipgloss.AdaptiveColor{Light: "#b341e7", Dark: "#b341e7"}
+	"help_section": {Light: "#000050", Dark: "#80A0FF"},
+	"help_plugins": {Light: "#000050", Dark: "#A080FF"},
+	"help_desc":    {Light: "#000050", Dark: "#FFFFFF"},
 
-	tabSelectedBgColor = helpBgColor
-	tabBgColor = sortBgColor
+	//Icon Colors
+	"excel": {Light: "#000050", Dark: "#55a600"},
+	"doc":   {Light: "#000050", Dark: "#2e6fe4"},
+	"pdf":   {Light: "#000050", Dark: "#c23737"},
 
-	helpSectionColor = lipgloss.AdaptiveColor{Light: "#000050", Dark: "#80A0FF"}
-	helpPluginsColor = lipgloss.AdaptiveColor{Light: "#000050", Dark: "#A080FF"}
-	helpKeyColor = filterBgColor
-	helpDescColor = lipgloss.AdaptiveColor{Light: "#000050", Dark: "#FFFFFF"}
+	// Special files
+	"executable":  {Light: "#1a7f37", Dark: "#55d655"},
+	"broken_link": {Light: "#c23737", Dark: "#ff5f5f"},
+	"special":     {Light: "#9a6700", Dark: "#d7af00"},
+	"setuid":      {Light: "#FFFFFF", Dark: "#FFFFFF"},
+	"setuid_bg":   {Light: "#c23737", Dark: "#c23737"},
 
-	cursorColor = filterBgColor
+	// pink #e9516a
+}
 
-	symDirColor = tabSelectedBgColor
-	dirColor = tabSelectedBgColor
+// Colors that are the same as another color unless a theme overrides them
+var colorAliases = map[string]string{
+	"cursor_bg":    "subtle",
+	"heading_bg":   "subtle",
+	"status_bg":    "subtle",
+	"sel_stats_bg": "selected_bg",
 
-	//Icon Colors
-	excelColor = lipgloss.AdaptiveColor{Light: "#000050", Dark: "#55a600"}
-	docColor = lipgloss.AdaptiveColor{Light: "#000050", Dark: "#2e6fe4"}
-	pdfColor = lipgloss.AdaptiveColor{Light: "#000050", Dark: "#c23737"}
+	"tab_selected_bg": "help_bg",
+	"tab_bg":          "sort_bg",
 
-	// pink #e9516a
+	"help_key": "filter_bg",
+	"cursor":   "filter_bg",
+
+	"sym_dir": "tab_selected_bg",
+	"dir":     "tab_selected_bg",
+
+	// For file modification time
+	"age_hour":  "help_bg",
+	"age_day":   "help_bg",
+	"age_week":  "sort_bg",
+	"age_month": "bright_white",
+	"age_year":  "white",
+
+	// For file size
+	"size_byte": "white",
+	"size_kilo": "bright_white",
+	"size_mega": "sort_bg",
+	"size_giga": "help_bg",
+
+	// Bars in du mode
+	"du_bar": "filter_bg",
+
+	// Indentation guides in tree mode
+	"tree_guide": "white",
+
+	// Files to copy in compare mode
+	"compare_left":  "executable",
+	"compare_right": "special",
+}
+
+// Set by buildStyles
+var (
+	subtleColor        lipgloss.TerminalColor
+	cursorBgColor      lipgloss.TerminalColor
+	headingBarBg       lipgloss.TerminalColor
+	statusBarBg        lipgloss.TerminalColor
+	selectedColor      lipgloss.TerminalColor
+	selectedBgColor    lipgloss.TerminalColor
+	selStatsBgColor    lipgloss.TerminalColor
+	activeColor        lipgloss.TerminalColor
+	inactiveColor      lipgloss.TerminalColor
+	statusColor        lipgloss.TerminalColor
+	whiteColor         lipgloss.TerminalColor
+	brightWhiteColor   lipgloss.TerminalColor
+	commandBgColor     lipgloss.TerminalColor
+	filterBgColor      lipgloss.TerminalColor
+	sortBgColor        lipgloss.TerminalColor
+	helpBgColor        lipgloss.TerminalColor
+	tabSelectedBgColor lipgloss.TerminalColor
+	tabBgColor         lipgloss.TerminalColor
+	helpSectionColor   lipgloss.TerminalColor
+	helpPluginsColor   lipgloss.TerminalColor
+	helpKeyColor       lipgloss.TerminalColor
+	helpDescColor      lipgloss.TerminalColor
+	cursorColor        lipgloss.TerminalColor
+	symDirColor        lipgloss.TerminalColor
+	dirColor           lipgloss.TerminalColor
+	excelColor         lipgloss.TerminalColor
+	docColor           lipgloss.TerminalColor
+	pdfColor           lipgloss.TerminalColor
+	executableColor    lipgloss.TerminalColor
+	brokenLinkColor    lipgloss.TerminalColor
+	specialColor       lipgloss.TerminalColor
+	setuidColor        lipgloss.TerminalColor
+	setuidBgColor      lipgloss.TerminalColor
+	hourColor          lipgloss.TerminalColor
+	dayColor           lipgloss.TerminalColor
+	weekColor          lipgloss.TerminalColor
+	monthColor         lipgloss.TerminalColor
+	yearColor          lipgloss.TerminalColor
+	byteColor          lipgloss.TerminalColor
+	kByteColor         lipgloss.TerminalColor
+	mByteColor         lipgloss.TerminalColor
+	gByteColor         lipgloss.TerminalColor
+	duBarColor         lipgloss.TerminalColor
+	treeGuideColor     lipgloss.TerminalColor
+	compareLeftColor   lipgloss.TerminalColor
+	compareRightColor  lipgloss.TerminalColor
+
+	rSection     func(...string) string
+	rKey         func(...string) string
+	rDesc        func(...string) string
+	rCwd         func(...string) string
+	rSubtle      func(...string) string
+	rTabSelected func(...string) string
+	rTabActive   func(...string) string
+	rTabInactive func(...string) string
+	rCommand     func(...string) string
+	riCommand    func(...string) string
+	rFilter      func(...string) string
+	riFilter     func(...string) string
+	rFilterText  func(...string) string
+	rSort        func(...string) string
+	rHelp        func(...string) string
+	riHelp       func(...string) string
+	rStats       func(...string) string
+	rSelStats    func(...string) string
+
+	cursorStyle  lipgloss.Style
+	selected     lipgloss.Style
+	spinnerStyle lipgloss.Style
+	directory    lipgloss.Style
+	symDirectory lipgloss.Style
+	excel        lipgloss.Style
+	wordDoc      lipgloss.Style
+	pdf          lipgloss.Style
+	fileDefault  lipgloss.Style
+	executable   lipgloss.Style
+	brokenLink   lipgloss.Style
+	okStyle      lipgloss.Style // Checks that passed
+	failedStyle  lipgloss.Style // Checks that failed
+	specialFile  lipgloss.Style
+	setuidFile   lipgloss.Style
+	hourStyle    lipgloss.Style
+	dayStyle     lipgloss.Style
+	weekStyle    lipgloss.Style
+	monthStyle   lipgloss.Style
+	yearStyle    lipgloss.Style
+	byteStyle    lipgloss.Style
+	kByteStyle   lipgloss.Style
+	mByteStyle   lipgloss.Style
+	gByteStyle   lipgloss.Style
+	duBar        lipgloss.Style
+	treeGuide    lipgloss.Style
+	compareLeft  lipgloss.Style
+	compareRight lipgloss.Style
+)
+
+// Builds the styles from the colors of the current theme.  This must be
+// called after the config is loaded.
+func buildStyles() {
+	subtleColor        = themeColor("subtle")
+	cursorBgColor      = themeColor("cursor_bg")
+	headingBarBg       = themeColor("heading_bg")
+	statusBarBg        = themeColor("status_bg")
+	selectedColor      = themeColor("selected")
+	selectedBgColor    = themeColor("selected_bg")
+	selStatsBgColor    = themeColor("sel_stats_bg")
+	activeColor        = themeColor("active")
+	inactiveColor      = themeColor("inactive")
+	statusColor        = themeColor("status")
+	whiteColor         = themeColor("white")
+	brightWhiteColor   = themeColor("bright_white")
+	commandBgColor     = themeColor("command_bg")
+	filterBgColor      = themeColor("filter_bg")
+	sortBgColor        = themeColor("sort_bg")
+	helpBgColor        = themeColor("help_bg")
+	tabSelectedBgColor = themeColor("tab_selected_bg")
+	tabBgColor         = themeColor("tab_bg")
+	helpSectionColor   = themeColor("help_section")
+	helpPluginsColor   = themeColor("help_plugins")
+	helpKeyColor       = themeColor("help_key")
+	helpDescColor      = themeColor("help_desc")
+	cursorColor        = themeColor("cursor")
+	symDirColor        = themeColor("sym_dir")
+	dirColor           = themeColor("dir")
+	excelColor         = themeColor("excel")
+	docColor           = themeColor("doc")
+	pdfColor           = themeColor("pdf")
+	executableColor    = themeColor("executable")
+	brokenLinkColor    = themeColor("broken_link")
+	specialColor       = themeColor("special")
+	setuidColor        = themeColor("setuid")
+	setuidBgColor      = themeColor("setuid_bg")
+	hourColor          = themeColor("age_hour")
+	dayColor           = themeColor("age_day")
+	weekColor          = themeColor("age_week")
+	monthColor         = themeColor("age_month")
+	yearColor          = themeColor("age_year")
+	byteColor          = themeColor("size_byte")
+	kByteColor         = themeColor("size_kilo")
+	mByteColor         = themeColor("size_mega")
+	gByteColor         = themeColor("size_giga")
+	duBarColor         = themeColor("du_bar")
+	treeGuideColor     = themeColor("tree_guide")
+	compareLeftColor   = themeColor("compare_left")
+	compareRightColor  = themeColor("compare_right")
 
 	rSection = lipgloss.NewStyle().
 		Foreground(helpSectionColor).
@@ -95,7 +274,6 @@ var (
 		Padding(0, 1).
 		Render
 
-
 	rTabInactive = lipgloss.NewStyle().
 		Foreground(inactiveColor).
 		Background(headingBarBg).
@@ -113,7 +291,6 @@ var (
 		Background(statusBarBg).
 		Render
 
-
 	rFilter = lipgloss.NewStyle().
 		Foreground(whiteColor).
 		Background(filterBgColor).
@@ -125,7 +302,6 @@ var (
 		Background(statusBarBg).
 		Render
 
-
 	rFilterText = lipgloss.NewStyle().
 		Background(subtleColor).
 		Italic(true).
@@ -153,6 +329,11 @@ var (
 		Padding(0, 1).
 		Render
 
+	// For background jobs in the footer
+	spinnerStyle = lipgloss.NewStyle().
+		Foreground(cursorColor).
+		Background(subtleColor)
+
 	rSelStats = lipgloss.NewStyle().
 		Foreground(brightWhiteColor).
 		Background(selStatsBgColor).
@@ -177,104 +358,62 @@ var (
 	fileDefault = lipgloss.NewStyle().
 		Foreground(whiteColor)
 
+	executable = lipgloss.NewStyle().
+		Foreground(executableColor)
+
+	brokenLink = lipgloss.NewStyle().
+		Foreground(brokenLinkColor).
+		Strikethrough(true)
+
+	okStyle = lipgloss.NewStyle().
+		Foreground(executableColor)
+
+	failedStyle = lipgloss.NewStyle().
+		Foreground(brokenLinkColor)
+
+	// Sockets, pipes and devices
+	specialFile = lipgloss.NewStyle().
+		Foreground(specialColor)
+
+	setuidFile = lipgloss.NewStyle().
+		Foreground(setuidColor).
+		Background(setuidBgColor)
+
 	// For file modification time
 	hourStyle = lipgloss.NewStyle().
-		Foreground(helpBgColor)
+		Foreground(hourColor)
 	dayStyle = lipgloss.NewStyle().
-		Foreground(helpBgColor)
+		Foreground(dayColor)
 	weekStyle = lipgloss.NewStyle().
-		Foreground(sortBgColor)
+		Foreground(weekColor)
 	monthStyle = lipgloss.NewStyle().
-		Foreground(brightWhiteColor)
+		Foreground(monthColor)
 	yearStyle = lipgloss.NewStyle().
-		Foreground(whiteColor)
+		Foreground(yearColor)
 
 	// For file size
 	byteStyle = lipgloss.NewStyle().
-		Foreground(whiteColor)
+		Foreground(byteColor)
 
 	kByteStyle = lipgloss.NewStyle().
-		Foreground(brightWhiteColor)
+		Foreground(kByteColor)
 
 	mByteStyle = lipgloss.NewStyle().
-		Foreground(sortBgColor)
+		Foreground(mByteColor)
 
 	gByteStyle = lipgloss.NewStyle().
-		Foreground(helpBgColor)
-)
+		Foreground(gByteColor)
+
+	duBar = lipgloss.NewStyle().
+		Foreground(duBarColor).
+		Background(subtleColor)
+
+	treeGuide = lipgloss.NewStyle().
+		Foreground(treeGuideColor)
 
+	compareLeft = lipgloss.NewStyle().
+		Foreground(compareLeftColor)
 
-// return nerd font icon for filetype
-func getIcon(dir string, file fs.DirEntry) (string) {
-	if file.IsDir() {
-		return ""
-	}
-	if isSymDir(dir, file) {
-		return ""
-	}
-
-	if file.Type() & os.ModeSymlink != 0 {
-		return ""
-	}
-	if file.Type() & os.ModeDevice != 0 {
-		return ""
-	}
-	if file.Type() & os.ModeNamedPipe != 0 {
-		return "󰟥"
-	}
-
-	if strings.HasSuffix(file.Name(), ".pdf") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".html") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".xml") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".htm") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".tgz") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".tar") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".zip") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".gz") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".bz2") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".txt") {
-		return ""
-	}
-	if strings.HasSuffix(file.Name(), ".xlsx") {
-		return "󰈛"
-	}
-	if strings.HasSuffix(file.Name(), ".xls") {
-		return "󰈛"
-	}
-	if strings.HasSuffix(file.Name(), ".png") {
-		return "󰈟"
-	}
-	if strings.HasSuffix(file.Name(), ".jpg") {
-		return "󰈟"
-	}
-	if strings.HasSuffix(file.Name(), ".jepg") {
-		return "󰈟"
-	}
-	if strings.HasSuffix(file.Name(), ".gif") {
-		return "󰈟"
-	}
-	if strings.HasSuffix(file.Name(), ".webp") {
-		return "󰈟"
-	}
-
-	//doc.WriteString("  file.bin\n")
-	return "󰈔"
+	compareRight = lipgloss.NewStyle().
+		Foreground(compareRightColor)
 }
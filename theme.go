@@ -0,0 +1,192 @@
+// This file contains code for color themes.  A theme overrides the named
+// colors in style.go.  Themes are either built in or read from
+// ~/.config/bfm/themes/<name>.toml, and the [theme] section of bfmrc can
+// override colors of the chosen theme.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type builtinTheme struct {
+	variant string // "light", "dark", or "" to adapt to the terminal
+	colors  map[string]string
+}
+
+var builtinThemes = map[string]builtinTheme{
+	"default": {},
+	"light":   {variant: "light"},
+	"dark":    {variant: "dark"},
+	"high-contrast": {variant: "dark", colors: map[string]string{
+		"subtle":       "#000000",
+		"cursor_bg":    "#404040",
+		"selected":     "#FFFFFF",
+		"selected_bg":  "#0000FF",
+		"active":       "#FFFFFF",
+		"inactive":     "#AAAAAA",
+		"white":        "#FFFFFF",
+		"bright_white": "#FFFFFF",
+		"command_bg":   "#0000C0",
+		"filter_bg":    "#C00000",
+		"sort_bg":      "#006000",
+		"help_bg":      "#800080",
+		"help_section": "#00FFFF",
+		"help_plugins": "#FF80FF",
+		"help_desc":    "#FFFFFF",
+		"help_key":     "#FFFF00",
+		"cursor":       "#FFFF00",
+		"dir":          "#00FFFF",
+		"sym_dir":      "#00C0C0",
+		"excel":        "#00FF00",
+		"doc":          "#80A0FF",
+		"pdf":          "#FF6060",
+		"executable":   "#00FF00",
+		"broken_link":  "#FF0000",
+		"special":      "#FFFF00",
+		"setuid":       "#FFFFFF",
+		"setuid_bg":    "#C00000",
+		"age_hour":     "#FFFF00",
+		"age_day":      "#FFFFFF",
+		"age_week":     "#C0C0C0",
+		"age_month":    "#A0A0A0",
+		"age_year":     "#808080",
+		"size_byte":    "#A0A0A0",
+		"size_kilo":    "#FFFFFF",
+		"size_mega":    "#FFFF00",
+		"size_giga":    "#FF6060",
+	}},
+}
+
+// Set by LoadTheme
+var (
+	themeVariant   string
+	themeOverrides = map[string]string{}
+)
+
+var hexColorRe = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Returns true if c is a hex color or an ANSI color number
+func validColor(c string) bool {
+	if hexColorRe.MatchString(c) {
+		return true
+	}
+	n, err := strconv.Atoi(c)
+	return err == nil && n >= 0 && n <= 255
+}
+
+// Returns true if key names a color that themes can set
+func knownColor(key string) bool {
+	_, isColor := defaultColors[key]
+	_, isAlias := colorAliases[key]
+	return isColor || isAlias
+}
+
+// Returns the color named key in the current theme
+func themeColor(key string) lipgloss.TerminalColor {
+	if c, found := themeOverrides[key]; found {
+		return lipgloss.Color(c)
+	}
+	if alias, found := colorAliases[key]; found {
+		return themeColor(alias)
+	}
+
+	c, found := defaultColors[key]
+	if !found {
+		log.Fatalf("Unknown theme color %s", key)
+	}
+	switch themeVariant {
+	case "light":
+		return lipgloss.Color(c.Light)
+	case "dark":
+		return lipgloss.Color(c.Dark)
+	}
+	return c
+}
+
+func themePath(name string) string {
+	return filepath.Join(home, ".config/bfm/themes", name+".toml")
+}
+
+func readThemeFile(name string) (Theme, error) {
+	var theme Theme
+	_, err := toml.DecodeFile(themePath(name), &theme)
+	return theme, err
+}
+
+// Loads the theme named in bfmrc and rebuilds the styles.  Theme files may
+// be based on another theme, which provides the colors they do not set.
+// Returns the problems found with the theme.
+func LoadTheme() []string {
+	problems := []string{}
+
+	themeVariant = ""
+	themeOverrides = map[string]string{}
+
+	// Colors from [theme] in bfmrc take precedence over the theme's
+	merge := func(source string, colors map[string]string) {
+		keys := []string{}
+		for key := range colors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			c := colors[key]
+			if !knownColor(key) {
+				problems = append(problems, fmt.Sprintf("%s: unknown color %s", source, key))
+				continue
+			}
+			if !validColor(c) {
+				problems = append(problems, fmt.Sprintf("%s: invalid color %q for %s", source, c, key))
+				continue
+			}
+			if _, found := themeOverrides[key]; !found {
+				themeOverrides[key] = c
+			}
+		}
+	}
+	merge("bfmrc", config.Theme.Colors)
+
+	name := config.Theme.Name
+	visited := map[string]bool{}
+	for name != "" {
+		if visited[name] {
+			problems = append(problems, "Theme "+name+" is based on itself")
+			break
+		}
+		visited[name] = true
+
+		if builtin, found := builtinThemes[name]; found {
+			log.Printf("Using built-in theme %s", name)
+			themeVariant = builtin.variant
+			merge(name, builtin.colors)
+			break
+		}
+
+		log.Printf("Loading theme %s", themePath(name))
+		theme, err := readThemeFile(name)
+		if os.IsNotExist(err) {
+			problems = append(problems, "Theme "+name+" not found in "+filepath.Dir(themePath(name)))
+			break
+		}
+		if err != nil {
+			problems = append(problems, "Error reading theme "+name+": "+err.Error())
+			break
+		}
+		merge(name, theme.Colors)
+		name = theme.Base
+	}
+
+	buildStyles()
+	return problems
+}
@@ -0,0 +1,214 @@
+// This file contains tree mode, which lists the files of expanded directories
+// under them with indentation guides.  Nested files are named by their path
+// relative to the tab's directory, so everything that joins the tab's
+// directory and the name of a listed file works on them unchanged.
+
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// A file listed from a directory below the tab's directory, which is an
+// expanded directory in tree mode
+type treeEntry struct {
+	fs.DirEntry
+	path  string // Relative to the tab's directory
+	depth int    // 1 for the files of a directory in the tab's directory
+	guide string // Indentation guides drawn before the name
+}
+
+func (e *treeEntry) Name() string {
+	return e.path
+}
+
+// Returns the directory a listed file is really in and its entry there
+func realEntry(dir string, f fs.DirEntry) (string, fs.DirEntry) {
+	if e, ok := f.(*treeEntry); ok {
+		return filepath.Join(dir, filepath.Dir(e.path)), e.DirEntry
+	}
+	return dir, f
+}
+
+// Lists the tab's files with the files of expanded directories under them.
+// While filtering, a directory stays listed if files under it match.
+func (td *tabData) filterTree() {
+	var query *Query
+	if td.filter != "" {
+		query = ParseQuery(td.filter)
+	}
+	td.treeContext = map[string]bool{}
+	td.filteredFiles = td.treeLevel("", 0, td.files, query)
+	setTreeGuides(td.filteredFiles)
+}
+
+// Returns the sorted files of the directory at rel, each followed by the
+// files under it when it is expanded
+func (td *tabData) treeLevel(rel string, depth int, files []fs.DirEntry, query *Query) []fs.DirEntry {
+	level := []fs.DirEntry{}
+	below := map[string][]fs.DirEntry{}
+	for _, f := range files {
+		if !td.showHidden && strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		entry := f
+		if depth > 0 {
+			entry = &treeEntry{DirEntry: f, path: filepath.Join(rel, f.Name()), depth: depth}
+		}
+
+		var children []fs.DirEntry
+		if expanded, ok := td.expanded[entry.Name()]; ok {
+			children = td.treeLevel(entry.Name(), depth+1, expanded, query)
+		}
+		if query != nil && query.EvalFile(realEntry(td.absdir, entry)) == 0 {
+			if len(children) == 0 {
+				continue
+			}
+			td.treeContext[entry.Name()] = true
+		}
+
+		level = append(level, entry)
+		below[entry.Name()] = children
+	}
+
+	td.sortFiles(level)
+
+	listed := []fs.DirEntry{}
+	for _, entry := range level {
+		listed = append(listed, entry)
+		listed = append(listed, below[entry.Name()]...)
+	}
+	return listed
+}
+
+// Draws the guides of the nested files in listed, working up from the bottom
+// so it is known which directories have more files below
+func setTreeGuides(listed []fs.DirEntry) {
+	more := []bool{} // By depth, whether a later file has the same parent
+	for i := len(listed) - 1; i >= 0; i-- {
+		e, nested := listed[i].(*treeEntry)
+		depth := 0
+		if nested {
+			depth = e.depth
+		}
+
+		for len(more) <= depth {
+			more = append(more, false)
+		}
+		more = more[:depth+1]
+
+		if nested {
+			guide := strings.Builder{}
+			for d := 1; d < depth; d++ {
+				if more[d] {
+					guide.WriteString("│  ")
+				} else {
+					guide.WriteString("   ")
+				}
+			}
+			if more[depth] {
+				guide.WriteString("├─ ")
+			} else {
+				guide.WriteString("└─ ")
+			}
+			e.guide = guide.String()
+		}
+		more[depth] = true
+	}
+}
+
+// Turns tree mode on or off for the tab
+func (m *model) ToggleTree() {
+	ct := m.CurrentTab
+	hovered := ""
+	if m.isHoveredValid() {
+		hovered = m.getHoveredDirEntry().Name()
+	}
+
+	ct.tree = !ct.tree
+	if ct.flat {
+		// Errors are shown by the refresh that follows
+		ct.flat = false
+		ct.files, _ = getDirEntries(ct.directory)
+	}
+	ct.filterFiles()
+
+	// A nested file is no longer listed, so land on the directory it is in
+	ct.cursor = 0
+	ct.JumpToFile(strings.Split(hovered, string(filepath.Separator))[0])
+}
+
+// Expands or collapses the hovered directory, turning on tree mode if it is
+// off.  On a nested file, collapses the directory the file is in.
+func (m *model) ToggleExpand() {
+	ct := m.CurrentTab
+	if !m.isHoveredValid() {
+		return
+	}
+	if !ct.tree {
+		m.ToggleTree()
+	}
+
+	name := m.getHoveredDirEntry().Name()
+	if _, expanded := ct.expanded[name]; expanded {
+		ct.collapse(name)
+		ct.ReRunFilter()
+		return
+	}
+
+	if m.isHoveredDir() {
+		files, err := getDirEntries(filepath.Join(ct.directory, name))
+		if err != nil {
+			m.appendError("Error expanding " + name + ": " + err.Error())
+			return
+		}
+		if ct.expanded == nil {
+			ct.expanded = map[string][]fs.DirEntry{}
+		}
+		ct.expanded[name] = files
+		ct.ReRunFilter()
+		return
+	}
+
+	if parent := filepath.Dir(name); parent != "." {
+		ct.collapse(parent)
+		ct.filterFiles()
+		ct.JumpToFile(parent)
+	}
+}
+
+// Collapses the directory at path and the expanded directories under it
+func (td *tabData) collapse(path string) {
+	for p := range td.expanded {
+		if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+			delete(td.expanded, p)
+		}
+	}
+}
+
+// Reads the expanded directories again.  Directories that are gone, like
+// ones that were renamed, are collapsed.
+func (td *tabData) reloadExpanded() {
+	for p := range td.expanded {
+		files, err := getDirEntries(filepath.Join(td.directory, p))
+		if err != nil {
+			delete(td.expanded, p)
+			continue
+		}
+		td.expanded[p] = files
+	}
+}
+
+// Returns the files of the directories listed in the tab, by directory
+func (td *tabData) listedDirs() map[string][]fs.DirEntry {
+	dirs := map[string][]fs.DirEntry{td.absdir: td.files}
+	if td.tree {
+		for p, files := range td.expanded {
+			dirs[filepath.Join(td.absdir, p)] = files
+		}
+	}
+	return dirs
+}
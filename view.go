@@ -18,12 +18,20 @@ const (
 	commandMode  = iota
 	filterMode   = iota
 	selectedMode = iota
+	panelMode    = iota
+	duMode       = iota
+	dupsMode     = iota
+	compareMode  = iota
 )
 
 const (
-	modifiedSort = iota
-	nameSort     = iota
-	sizeSort     = iota
+	modifiedSort  = iota
+	nameSort      = iota
+	sizeSort      = iota
+	naturalSort   = iota
+	extensionSort = iota
+	createdSort   = iota
+	typeSort      = iota
 )
 
 func GetModified(f fs.DirEntry) string {
@@ -65,8 +73,10 @@ func GetSize(f fs.DirEntry) string {
 	if err != nil {
 		return ""
 	}
+	return formatSize(info.Size())
+}
 
-	b := info.Size()
+func formatSize(b int64) string {
 	k := b / 1024
 	m := k / 1024
 	g := m / 1024
@@ -165,6 +175,16 @@ func (m model) headerView() string {
 	tt := lipgloss.JoinHorizontal(lipgloss.Top, tabs...)
 
 	cwd := rCwd(compressCWD(m.CurrentTab.directory))
+	if m.CurrentTab.archive != "" {
+		cwd += rSubtle("  (archive, read-only)")
+	}
+	if m.CurrentTab.flat {
+		if m.CurrentTab.flatTruncated {
+			cwd += rSubtle(fmt.Sprintf("  (flat, first %d files)", flattenMaxFiles))
+		} else {
+			cwd += rSubtle("  (flat)")
+		}
+	}
 	main := lipgloss.JoinHorizontal(lipgloss.Top, tt, rSubtle("   "), cwd)
 
 	fill := rSubtle(strings.Repeat(" ", Max(0, m.termWidth-lipgloss.Width(main))))
@@ -178,14 +198,22 @@ func (m model) headerView() string {
 	return fmt.Sprint(doc.String())
 }
 
-func renderModeStatus(mode int) string {
-	switch mode {
+func (m *model) renderModeStatus() string {
+	switch m.mode {
 	case commandMode:
 		return rCommand("COMMAND") + riCommand("")
 	case filterMode:
 		return rFilter("FILTER") + riFilter("")
 	case selectedMode:
 		return rFilter("SELECTED") + riFilter("")
+	case panelMode:
+		return rHelp(m.panel.title) + riHelp("")
+	case duMode:
+		return rHelp("DU") + riHelp("")
+	case dupsMode:
+		return rHelp("DUPS") + riHelp("")
+	case compareMode:
+		return rHelp("COMPARE") + riHelp("")
 	}
 	return ""
 }
@@ -226,24 +254,14 @@ func (m *model) renderSelectedStatus() string {
 }
 
 func (m *model) renderSortStatus() string {
-	if m.CurrentTab.sort == nameSort {
-		return rSort("NAM")
-	}
-	if m.CurrentTab.sort == modifiedSort {
-		return rSort("MOD")
-	}
-	if m.CurrentTab.sort == sizeSort {
-		return rSort("SIZ")
-	}
-	log.Fatalf("Unknown sort mode %d", m.CurrentTab.sort)
-	return ""
+	return rSort(m.CurrentTab.sortBadge())
 }
 
 func (m model) footerView() string {
 	doc := strings.Builder{}
 
 	doc.WriteString("\n")
-	mode := renderModeStatus(m.mode)
+	mode := m.renderModeStatus()
 	var filter string
 	if m.mode == filterMode {
 		filter = renderFilter(m.CurrentTab)
@@ -251,12 +269,15 @@ func (m model) footerView() string {
 	stats := renderStats(m.CurrentTab)
 	selStats := m.renderSelectedStatus()
 	sortStatus := m.renderSortStatus()
+	jobStatus := m.renderJobStatus()
+	readyStatus := m.renderReadyStatus()
+	dirSizeStatus := m.renderDirSizeStatus()
 	//scroll := m.renderScrollStatus()
 	help := rHelp("? : Help")
 
 	W := lipgloss.Width
 	//fcount := m.termWidth - W(mode) - W(filter) - W(stats) - W(selStats) - W(sortStatus) - W(scroll) - W(help)
-	fcount := m.termWidth - W(mode) - W(filter) - W(stats) - W(selStats) - W(sortStatus) - W(help)
+	fcount := m.termWidth - W(mode) - W(filter) - W(jobStatus) - W(readyStatus) - W(dirSizeStatus) - W(stats) - W(selStats) - W(sortStatus) - W(help)
 	fcount = Max(0, fcount)
 
 	fill := rSubtle(strings.Repeat(" ", fcount))
@@ -265,6 +286,9 @@ func (m model) footerView() string {
 		mode,
 		filter,
 		fill,
+		jobStatus,
+		readyStatus,
+		dirSizeStatus,
 		stats,
 		selStats,
 		sortStatus,
@@ -284,14 +308,29 @@ func (m *model) generateContent() string {
 		return m.generateSelected()
 	}
 
+	if m.mode == panelMode {
+		return m.panel.render(m)
+	}
+
+	if m.mode == duMode {
+		return m.generateDu()
+	}
+
+	if m.mode == dupsMode {
+		return m.generateDups()
+	}
+
+	if m.mode == compareMode {
+		return m.generateCompare()
+	}
+
 	ct := m.CurrentTab
 	doc := strings.Builder{}
 
-	// full makes this a responsive design
-	full := true
-	if m.termWidth < 50 { // Cutoff for displaying mod and size fields
-		full = false
-	}
+	m.requestDirSizes()
+
+	// Columns that do not fit are dropped, which makes this a responsive design
+	columns, maxNameWidth := layoutColumns(m.termWidth)
 
 	for i, f := range ct.filteredFiles {
 		cursorText := "  "
@@ -299,76 +338,44 @@ func (m *model) generateContent() string {
 			cursorText = "> "
 		}
 
-		icon := getIcon(ct.absdir, f)
+		// Files nested in tree mode are drawn with their own name and the
+		// styles of the directory they are in
+		dir, entry := realEntry(ct.absdir, f)
+		guide := ""
+		if e, nested := f.(*treeEntry); nested {
+			guide = e.guide
+		}
+		guideWidth := utf8.RuneCountInString(guide)
 
-		mod := "0d" // won't display
-		siz := "0K" // won't display
-		if full {
-			mod = GetModified(f)
-			siz = GetSize(f)
+		icon := ""
+		if showIcons {
+			icon = getIcon(dir, entry) + " "
 		}
 
-		// Cursor:2 Icon:2, Mod:2, Size:6
-		maxNameWidth := m.termWidth - 2 - 2
-		if full {
-			maxNameWidth = maxNameWidth - 6 - 6
+		// Flat listings show the path relative to the tab's directory
+		name := f.Name()
+		if guide != "" {
+			name = entry.Name()
 		}
-		name := truncateFileName(f.Name(), maxNameWidth)
+		name = truncateFileName(name, Max(8, maxNameWidth-guideWidth))
 		nameWidth := utf8.RuneCountInString(name)
-		spaceWidth := maxNameWidth - nameWidth - 1
+		spaceWidth := maxNameWidth - guideWidth - nameWidth - 1
 
-		text := fmt.Sprintf("%s %-"+strconv.Itoa(nameWidth)+"s", icon, name)
+		text := fmt.Sprintf("%s%-"+strconv.Itoa(nameWidth)+"s", icon, name)
 		space := ""
 		if spaceWidth > 0 {
 			space = fmt.Sprintf("%"+strconv.Itoa(spaceWidth)+"s", " ")
 		}
 
-		fileStyle := fileDefault
-		if f.IsDir() {
-			fileStyle = directory
-		} else if isSymDir(ct.absdir, f) {
-			fileStyle = symDirectory
-		} else if strings.HasSuffix(strings.ToLower(f.Name()), ".xlsx") {
-			fileStyle = excel
-		} else if strings.HasSuffix(strings.ToLower(f.Name()), ".xls") {
-			fileStyle = excel
-		} else if strings.HasSuffix(strings.ToLower(f.Name()), ".xlsm") {
-			fileStyle = excel
-		} else if strings.HasSuffix(strings.ToLower(f.Name()), ".docx") {
-			fileStyle = wordDoc
-		} else if strings.HasSuffix(strings.ToLower(f.Name()), ".doc") {
-			fileStyle = wordDoc
-		} else if strings.HasSuffix(strings.ToLower(f.Name()), ".pdf") {
-			fileStyle = pdf
-		}
+		fileStyle := fileStyleFor(dir, entry)
 
 		spaceStyle := fileDefault
-
-		sizeStyle := byteStyle
-		if strings.HasSuffix(siz, "K") {
-			sizeStyle = kByteStyle
-		} else if strings.HasSuffix(siz, "M") {
-			sizeStyle = mByteStyle
-		} else if strings.HasSuffix(siz, "G") {
-			sizeStyle = gByteStyle
-		}
-
-		modStyle := hourStyle
-		if strings.HasSuffix(mod, "d") {
-			modStyle = dayStyle
-		} else if strings.HasSuffix(mod, "w") {
-			modStyle = weekStyle
-		} else if strings.HasSuffix(mod, "m") {
-			modStyle = monthStyle
-		} else if strings.HasSuffix(mod, "y") {
-			modStyle = yearStyle
-		}
+		guideStyle := treeGuide
 
 		if i == ct.cursor {
 			fileStyle = fileStyle.Copy().Background(cursorBgColor)
 			spaceStyle = spaceStyle.Copy().Background(cursorBgColor)
-			sizeStyle = sizeStyle.Copy().Background(cursorBgColor)
-			modStyle = modStyle.Copy().Background(cursorBgColor)
+			guideStyle = guideStyle.Copy().Background(cursorBgColor)
 		}
 
 		// Override if selected
@@ -377,11 +384,21 @@ func (m *model) generateContent() string {
 		}
 
 		doc.WriteString(cursorStyle.Render(cursorText)) // 2 characters
-		doc.WriteString(fileStyle.Render(text))
-		if full {
-			doc.WriteString(spaceStyle.Render(space))
-			doc.WriteString(modStyle.Render(fmt.Sprintf(" %5s", mod)))  // 6 characters
-			doc.WriteString(sizeStyle.Render(fmt.Sprintf(" %5s", siz))) // 6 characters
+		for j, column := range columns {
+			if j > 0 {
+				doc.WriteString(spaceStyle.Render(" "))
+			}
+			if column != "name" {
+				doc.WriteString(renderCell(column, dir, entry, i == ct.cursor))
+				continue
+			}
+			if guide != "" {
+				doc.WriteString(guideStyle.Render(guide))
+			}
+			doc.WriteString(fileStyle.Render(text))
+			if len(columns) > 1 {
+				doc.WriteString(spaceStyle.Render(space))
+			}
 		}
 		doc.WriteString("\n")
 	}